@@ -2,7 +2,9 @@ package entity
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
@@ -23,51 +25,119 @@ func NewEntityFromDER(certDer, keyDer []byte, algo x509.PublicKeyAlgorithm) (*En
 		return nil, err
 	}
 	entity.Cert = cert
-	switch algo {
-	case x509.RSA:
-		{
-			k, err := x509.ParsePKCS1PrivateKey(keyDer)
-			if err != nil {
-				return nil, err
-			}
-			entity.Key = k
-		}
-	case x509.ECDSA:
-		{
-			k, err := x509.ParseECPrivateKey(keyDer)
-			if err != nil {
-				return nil, err
-			}
-			entity.Key = k
-		}
-	default:
-		{
-			return nil, errors.New("unknown private key type")
-		}
+	key, err := ParsePrivateKeyDER(keyDer)
+	if err != nil {
+		return nil, err
+	}
+	if keyAlgorithm(key) != algo {
+		return nil, errors.New("private key does not match the given algorithm")
 	}
+	entity.Key = key
 	return entity, nil
 }
 
 func NewEntityFromPEM(cert []byte, key []byte) (*Entity, error) {
-	keyBlock, _ := pem.Decode(key)
-	if keyBlock == nil {
-		return nil, errors.New("no valid PEM data")
+	k, err := ParsePrivateKeyPEM(key)
+	if err != nil {
+		return nil, err
 	}
 	certBlock, _ := pem.Decode(cert)
 	if certBlock == nil {
 		return nil, errors.New("no valid PEM data")
 	}
-	switch keyBlock.Type {
-	case "RSA PRIVATE KEY":
-		{
-			return NewEntityFromDER(certBlock.Bytes, keyBlock.Bytes, x509.RSA)
+	c, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &Entity{Cert: c, Key: k, Algorithm: keyAlgorithm(k)}, nil
+}
+
+// CheckKey verifies that the private key belongs to the certificate
+func (entity *Entity) CheckKey() error {
+	signer, ok := entity.Key.(crypto.Signer)
+	if !ok {
+		return errors.New("unknown private key")
+	}
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(entity.Cert.PublicKey) {
+		return errors.New("private key does not match the certificate")
+	}
+	return nil
+}
+
+// ParsePrivateKeyDER parses a PKCS#1, SEC1 or PKCS#8 encoded private key
+func ParsePrivateKeyDER(der []byte) (interface{}, error) {
+	if k, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return k, nil
+	}
+	if k, err := x509.ParseECPrivateKey(der); err == nil {
+		return k, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, errors.New("unknown private key type")
+	}
+	switch k := k.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+		return k, nil
+	}
+	return nil, errors.New("unknown private key type")
+}
+
+// ParsePrivateKeyPEM parses the first private key block of PEM data,
+// skipping leading blocks like "EC PARAMETERS" as emitted by openssl
+func ParsePrivateKeyPEM(data []byte) (interface{}, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no valid PEM data")
 		}
-	case "EC PRIVATE KEY":
-		{
-			return NewEntityFromDER(certBlock.Bytes, keyBlock.Bytes, x509.ECDSA)
+		switch block.Type {
+		case "RSA PRIVATE KEY", "EC PRIVATE KEY", "PRIVATE KEY":
+			return ParsePrivateKeyDER(block.Bytes)
 		}
 	}
-	return nil, errors.New("unknown private key type")
+}
+
+// ParseCertificatePEM parses the first certificate of PEM data
+func ParseCertificatePEM(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no valid PEM data")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// ParseCertificateRequest parses a PEM or DER encoded PKCS#10 request and checks its signature
+func ParseCertificateRequest(data []byte) (*x509.CertificateRequest, error) {
+	der := data
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "CERTIFICATE REQUEST" && block.Type != "NEW CERTIFICATE REQUEST" {
+			return nil, errors.New("no certificate request in PEM data")
+		}
+		der = block.Bytes
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, err
+	}
+	if err = csr.CheckSignature(); err != nil {
+		return nil, err
+	}
+	return csr, nil
+}
+
+func keyAlgorithm(key interface{}) x509.PublicKeyAlgorithm {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return x509.RSA
+	case *ecdsa.PrivateKey:
+		return x509.ECDSA
+	case ed25519.PrivateKey:
+		return x509.Ed25519
+	}
+	return x509.UnknownPublicKeyAlgorithm
 }
 
 func NewEntityFromFile(cert, key string) (*Entity, error) {
@@ -92,6 +162,8 @@ func (entity *Entity) GetKeyAsDER() ([]byte, error) {
 		return x509.MarshalPKCS1PrivateKey(k), nil
 	case *ecdsa.PrivateKey:
 		return x509.MarshalECPrivateKey(k)
+	case ed25519.PrivateKey:
+		return x509.MarshalPKCS8PrivateKey(k)
 	}
 	return nil, errors.New("unknown private key")
 }
@@ -120,7 +192,26 @@ func (entity *Entity) GetKeyAsPEM() ([]byte, error) {
 		err = pem.Encode(out, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: der})
 	case *ecdsa.PrivateKey:
 		err = pem.Encode(out, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	case ed25519.PrivateKey:
+		err = pem.Encode(out, &pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func (entity *Entity) GetKeyAsPKCS8DER() ([]byte, error) {
+	return x509.MarshalPKCS8PrivateKey(entity.Key)
+}
+
+func (entity *Entity) GetKeyAsPKCS8PEM() ([]byte, error) {
+	der, err := entity.GetKeyAsPKCS8DER()
+	if err != nil {
+		return nil, err
 	}
+	out := &bytes.Buffer{}
+	err = pem.Encode(out, &pem.Block{Type: "PRIVATE KEY", Bytes: der})
 	if err != nil {
 		return nil, err
 	}
@@ -1,11 +1,24 @@
 package entity
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"io/ioutil"
+	"math/big"
 	"os/exec"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
 )
 
 func TestEntityRSA(t *testing.T) {
@@ -41,3 +54,134 @@ func TestEntityEC(t *testing.T) {
 	err = test2.Run()
 	assert.Nil(t, err)
 }
+
+func TestEntityEd25519(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test-ed25519"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, priv.Public(), priv)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalPKCS8PrivateKey(priv)
+	assert.Nil(t, err)
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer})
+	entity, err := NewEntityFromPEM(certPem, keyPem)
+	assert.Nil(t, err)
+	assert.Equal(t, priv, entity.Key)
+	keyPemCopy, err := entity.GetKeyAsPEM()
+	assert.Nil(t, err)
+	assert.Equal(t, keyPem, keyPemCopy)
+}
+
+func TestEntityPKCS8(t *testing.T) {
+	for _, name := range []string{"test-rsa", "test-ec"} {
+		entity, err := NewEntityFromFile(name+".crt", name+".key")
+		assert.Nil(t, err)
+		pkcs8Pem, err := entity.GetKeyAsPKCS8PEM()
+		assert.Nil(t, err)
+		certPem, err := entity.GetCertAsPEM()
+		assert.Nil(t, err)
+		restored, err := NewEntityFromPEM(certPem, pkcs8Pem)
+		assert.Nil(t, err)
+		assert.Equal(t, entity.Key, restored.Key)
+		assert.Equal(t, entity.Algorithm, restored.Algorithm)
+		legacyPem, err := restored.GetKeyAsPEM()
+		assert.Nil(t, err)
+		original, err := ioutil.ReadFile(name + ".key")
+		assert.Nil(t, err)
+		assert.Equal(t, original, legacyPem)
+	}
+}
+
+func TestCheckKey(t *testing.T) {
+	entity, err := NewEntityFromFile("test-rsa.crt", "test-rsa.key")
+	assert.NoError(t, err)
+	assert.NoError(t, entity.CheckKey())
+	entity, err = NewEntityFromFile("test-rsa.crt", "test-ec.key")
+	assert.NoError(t, err)
+	assert.Error(t, entity.CheckKey())
+}
+
+func TestEncryptedPKCS8(t *testing.T) {
+	entity, err := NewEntityFromFile("test-ec.crt", "test-ec.key")
+	assert.NoError(t, err)
+	for _, kdf := range []string{"scrypt", "pbkdf2"} {
+		encrypted, err := entity.GetKeyAsEncryptedPKCS8PEM([]byte("secret"), kdf)
+		assert.NoError(t, err)
+		block, _ := pem.Decode(encrypted)
+		assert.Equal(t, "ENCRYPTED PRIVATE KEY", block.Type)
+		key, err := DecryptPKCS8PEM(encrypted, []byte("secret"))
+		assert.NoError(t, err)
+		assert.Equal(t, entity.Key, key)
+		_, err = DecryptPKCS8PEM(encrypted, []byte("wrong"))
+		assert.Error(t, err)
+	}
+	data, err := unpad([]byte{1, 2, 3, 3, 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 2}, data)
+	for _, padded := range [][]byte{{1, 2, 3, 2, 3}, {1, 2, 0}, {1, 17}, {2}, {}} {
+		_, err = unpad(padded)
+		assert.Error(t, err)
+	}
+	_, err = entity.GetKeyAsEncryptedPKCS8PEM([]byte("secret"), "md5")
+	assert.Error(t, err)
+	_, err = entity.GetKeyAsEncryptedPKCS8PEM(nil, "scrypt")
+	assert.Error(t, err)
+}
+
+func TestPKCS7Certificates(t *testing.T) {
+	rsa, err := NewEntityFromFile("test-rsa.crt", "test-rsa.key")
+	assert.NoError(t, err)
+	ec, err := NewEntityFromFile("test-ec.crt", "test-ec.key")
+	assert.NoError(t, err)
+	der, err := EncodePKCS7Certificates([]*x509.Certificate{rsa.Cert, ec.Cert})
+	assert.NoError(t, err)
+	certs, err := ParsePKCS7Certificates(der)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(certs))
+	assert.Equal(t, rsa.Cert.Raw, certs[0].Raw)
+	assert.Equal(t, ec.Cert.Raw, certs[1].Raw)
+	_, err = ParsePKCS7Certificates(rsa.Cert.Raw)
+	assert.Error(t, err)
+}
+
+func TestJWK(t *testing.T) {
+	entity, err := NewEntityFromFile("test-ec.crt", "test-ec.key")
+	assert.NoError(t, err)
+	jwk, err := NewJWK(entity.Cert.PublicKey, []*x509.Certificate{entity.Cert})
+	assert.NoError(t, err)
+	assert.Equal(t, "EC", jwk.Kty)
+	pub := entity.Cert.PublicKey.(*ecdsa.PublicKey)
+	x, _ := base64.RawURLEncoding.DecodeString(jwk.X)
+	assert.Equal(t, pub.X, new(big.Int).SetBytes(x))
+	assert.Equal(t, (pub.Curve.Params().BitSize+7)/8, len(x))
+	members, _ := json.Marshal(map[string]string{"crv": jwk.Crv, "kty": jwk.Kty, "x": jwk.X, "y": jwk.Y})
+	thumbprint := sha256.Sum256(members)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(thumbprint[:]), jwk.Kid)
+	assert.Equal(t, []string{base64.StdEncoding.EncodeToString(entity.Cert.Raw)}, jwk.X5c)
+
+	pubKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	jwk, err = NewJWK(pubKey, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "OKP", jwk.Kty)
+	assert.Equal(t, "Ed25519", jwk.Crv)
+	assert.Empty(t, jwk.X5c)
+}
+
+func TestKRL(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	caKey, err := ssh.NewPublicKey(pub)
+	assert.NoError(t, err)
+	krl := EncodeKRL(caKey, []uint64{7, 3, 7}, 1, time.Unix(1000, 0))
+	assert.Equal(t, []byte("SSHKRL\n\x00"), krl[:8])
+	serials := []byte{0x20, 0, 0, 0, 16, 0, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0, 7}
+	assert.Equal(t, serials, krl[len(krl)-len(serials):])
+	assert.True(t, bytes.Contains(krl, caKey.Marshal()))
+}
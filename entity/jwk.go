@@ -0,0 +1,74 @@
+package entity
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+)
+
+// JWK is a JSON Web Key (RFC 7517) of a public key
+type JWK struct {
+	Kty string   `json:"kty"`
+	Kid string   `json:"kid"`
+	Use string   `json:"use,omitempty"`
+	Crv string   `json:"crv,omitempty"`
+	N   string   `json:"n,omitempty"`
+	E   string   `json:"e,omitempty"`
+	X   string   `json:"x,omitempty"`
+	Y   string   `json:"y,omitempty"`
+	X5c []string `json:"x5c,omitempty"`
+}
+
+// JWKSet is a JSON Web Key Set
+type JWKSet struct {
+	Keys []*JWK `json:"keys"`
+}
+
+// NewJWK returns the JWK of a public key, the kid is its RFC 7638 thumbprint.
+// The certificate chain, starting with the certificate of the key, is added as x5c.
+func NewJWK(pub crypto.PublicKey, chain []*x509.Certificate) (*JWK, error) {
+	jwk := &JWK{Use: "sig"}
+	var thumbprintInput string
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64url(k.N.Bytes())
+		jwk.E = base64url(big.NewInt(int64(k.E)).Bytes())
+		thumbprintInput = fmt.Sprintf(`{"e":"%v","kty":"RSA","n":"%v"}`, jwk.E, jwk.N)
+	case *ecdsa.PublicKey:
+		jwk.Kty = "EC"
+		switch k.Curve.Params().Name {
+		case "P-256", "P-384", "P-521":
+			jwk.Crv = k.Curve.Params().Name
+		default:
+			return nil, fmt.Errorf("curve %v is not supported by JWK", k.Curve.Params().Name)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk.X = base64url(k.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64url(k.Y.FillBytes(make([]byte, size)))
+		thumbprintInput = fmt.Sprintf(`{"crv":"%v","kty":"EC","x":"%v","y":"%v"}`, jwk.Crv, jwk.X, jwk.Y)
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64url(k)
+		thumbprintInput = fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%v"}`, jwk.X)
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+	thumbprint := sha256.Sum256([]byte(thumbprintInput))
+	jwk.Kid = base64url(thumbprint[:])
+	for _, cert := range chain {
+		jwk.X5c = append(jwk.X5c, base64.StdEncoding.EncodeToString(cert.Raw))
+	}
+	return jwk, nil
+}
+
+func base64url(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
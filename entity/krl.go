@@ -0,0 +1,56 @@
+package entity
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// OpenSSH key revocation list format, see PROTOCOL.krl in the OpenSSH sources
+const (
+	krlMagic                 = 0x5353484b524c0a00
+	krlFormatVersion         = 1
+	krlSectionCertificates   = 1
+	krlSectionCertSerialList = 0x20
+)
+
+// EncodeKRL returns an unsigned OpenSSH KRL revoking the certificates with the given serials signed by caKey
+func EncodeKRL(caKey ssh.PublicKey, serials []uint64, version uint64, generated time.Time) []byte {
+	sorted := append([]uint64{}, serials...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	serialList := &bytes.Buffer{}
+	for idx, serial := range sorted {
+		if idx > 0 && serial == sorted[idx-1] {
+			continue
+		}
+		binary.Write(serialList, binary.BigEndian, serial)
+	}
+
+	certs := &bytes.Buffer{}
+	writeKRLString(certs, caKey.Marshal())
+	writeKRLString(certs, nil) // reserved
+	if serialList.Len() > 0 {
+		certs.WriteByte(krlSectionCertSerialList)
+		writeKRLString(certs, serialList.Bytes())
+	}
+
+	out := &bytes.Buffer{}
+	binary.Write(out, binary.BigEndian, uint64(krlMagic))
+	binary.Write(out, binary.BigEndian, uint32(krlFormatVersion))
+	binary.Write(out, binary.BigEndian, version)
+	binary.Write(out, binary.BigEndian, uint64(generated.Unix()))
+	binary.Write(out, binary.BigEndian, uint64(0)) // flags
+	writeKRLString(out, nil)                       // reserved
+	writeKRLString(out, nil)                       // comment
+	out.WriteByte(krlSectionCertificates)
+	writeKRLString(out, certs.Bytes())
+	return out.Bytes()
+}
+
+func writeKRLString(buf *bytes.Buffer, data []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	buf.Write(data)
+}
@@ -0,0 +1,227 @@
+package entity
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidScrypt         = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// key derivation parameters, scrypt uses the openssl defaults so keys can be decrypted within its memory limit
+const (
+	pbkdf2Iterations = 600000
+	scryptN          = 1 << 14
+	scryptR          = 8
+	scryptP          = 1
+	saltSize         = 16
+	aes256KeySize    = 32
+)
+
+// RFC 5958
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// RFC 8018
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	PRF            pkix.AlgorithmIdentifier
+}
+
+// RFC 7914
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+}
+
+// GetKeyAsEncryptedPKCS8PEM returns the key as "ENCRYPTED PRIVATE KEY" (PBES2 with AES-256-CBC).
+// The encryption key is derived from the passphrase using kdf, which is "scrypt" or "pbkdf2" (HMAC-SHA256).
+func (entity *Entity) GetKeyAsEncryptedPKCS8PEM(passphrase []byte, kdf string) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+	der, err := entity.GetKeyAsPKCS8DER()
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, saltSize)
+	iv := make([]byte, aes.BlockSize)
+	if _, err = rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err = rand.Read(iv); err != nil {
+		return nil, err
+	}
+	var (
+		key     []byte
+		kdfAlgo pkix.AlgorithmIdentifier
+	)
+	switch kdf {
+	case "", "scrypt":
+		key, err = scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, aes256KeySize)
+		if err != nil {
+			return nil, err
+		}
+		kdfAlgo.Algorithm = oidScrypt
+		kdfAlgo.Parameters.FullBytes, err = asn1.Marshal(scryptParams{salt, scryptN, scryptR, scryptP})
+	case "pbkdf2":
+		key = pbkdf2.Key(passphrase, salt, pbkdf2Iterations, aes256KeySize, sha256.New)
+		kdfAlgo.Algorithm = oidPBKDF2
+		kdfAlgo.Parameters.FullBytes, err = asn1.Marshal(pbkdf2Params{
+			Salt:           salt,
+			IterationCount: pbkdf2Iterations,
+			PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+		})
+	default:
+		return nil, fmt.Errorf("unknown key derivation function %v (try scrypt or pbkdf2)", kdf)
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	// PKCS#7 padding
+	padding := aes.BlockSize - len(der)%aes.BlockSize
+	encrypted := make([]byte, len(der)+padding)
+	copy(encrypted, der)
+	for i := len(der); i < len(encrypted); i++ {
+		encrypted[i] = byte(padding)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	ivParams, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: kdfAlgo,
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParams}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	out, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: encrypted,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: out}), nil
+}
+
+// DecryptPKCS8PEM decrypts an "ENCRYPTED PRIVATE KEY" as written by GetKeyAsEncryptedPKCS8PEM
+func DecryptPKCS8PEM(data, passphrase []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "ENCRYPTED PRIVATE KEY" {
+		return nil, errors.New("no encrypted private key in PEM data")
+	}
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(block.Bytes, &info); err != nil {
+		return nil, err
+	}
+	var params pbes2Params
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, errors.New("unsupported encryption, only PBES2 is supported")
+	}
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	if !params.EncryptionScheme.Algorithm.Equal(oidAES256CBC) {
+		return nil, errors.New("unsupported cipher, only AES-256-CBC is supported")
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+	var (
+		derived []byte
+		err     error
+	)
+	switch kdf := params.KeyDerivationFunc; {
+	case kdf.Algorithm.Equal(oidScrypt):
+		var p scryptParams
+		if _, err = asn1.Unmarshal(kdf.Parameters.FullBytes, &p); err != nil {
+			return nil, err
+		}
+		derived, err = scrypt.Key(passphrase, p.Salt, p.CostParameter, p.BlockSize, p.ParallelizationParameter, aes256KeySize)
+	case kdf.Algorithm.Equal(oidPBKDF2):
+		var p pbkdf2Params
+		if _, err = asn1.Unmarshal(kdf.Parameters.FullBytes, &p); err != nil {
+			return nil, err
+		}
+		if !p.PRF.Algorithm.Equal(oidHMACWithSHA256) {
+			return nil, errors.New("unsupported pseudo random function, only HMAC-SHA256 is supported")
+		}
+		derived = pbkdf2.Key(passphrase, p.Salt, p.IterationCount, aes256KeySize, sha256.New)
+	default:
+		return nil, errors.New("unsupported key derivation function")
+	}
+	if err != nil {
+		return nil, err
+	}
+	c, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize || len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid encrypted data")
+	}
+	der := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(c, iv).CryptBlocks(der, info.EncryptedData)
+	der, err = unpad(der)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, errors.New("wrong passphrase")
+	}
+	return key, nil
+}
+
+// unpad removes the PKCS#7 padding of decrypted data, all padding bytes have to
+// hold the padding length, otherwise the passphrase was wrong
+func unpad(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("wrong passphrase")
+	}
+	padding := int(data[len(data)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(data) {
+		return nil, errors.New("wrong passphrase")
+	}
+	for _, b := range data[len(data)-padding:] {
+		if int(b) != padding {
+			return nil, errors.New("wrong passphrase")
+		}
+	}
+	return data[:len(data)-padding], nil
+}
@@ -0,0 +1,144 @@
+package generator
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// checkConstraints verifies that the issuer is allowed to sign the template
+// regarding path length and name constraints. An unset path length of a sub-CA
+// is limited to what the issuer still allows. Sub-CAs inherit the name constraints
+// of the issuer, so that checking against the direct issuer covers the whole chain.
+func checkConstraints(issuer *x509.Certificate, template *x509.Certificate) error {
+	if template.IsCA && issuer.BasicConstraintsValid {
+		switch {
+		case issuer.MaxPathLen == 0 && issuer.MaxPathLenZero:
+			return fmt.Errorf("issuer %v is not allowed to issue sub-CAs (path length 0)", issuer.Subject.CommonName)
+		case issuer.MaxPathLen > 0:
+			if template.MaxPathLen == -1 || (template.MaxPathLen == 0 && !template.MaxPathLenZero) {
+				template.MaxPathLen = issuer.MaxPathLen - 1
+				template.MaxPathLenZero = template.MaxPathLen == 0
+			} else if template.MaxPathLen >= issuer.MaxPathLen {
+				return fmt.Errorf("path length %v exceeds what issuer %v allows (%v)", template.MaxPathLen, issuer.Subject.CommonName, issuer.MaxPathLen-1)
+			}
+		}
+	}
+	if template.IsCA {
+		if err := inheritNameConstraints(issuer, template); err != nil {
+			return err
+		}
+	}
+	for _, name := range template.DNSNames {
+		if len(issuer.PermittedDNSDomains) > 0 && !matchesAnyDomain(name, issuer.PermittedDNSDomains) {
+			return fmt.Errorf("dns name %v is not permitted by issuer %v", name, issuer.Subject.CommonName)
+		}
+		if matchesAnyDomain(name, issuer.ExcludedDNSDomains) {
+			return fmt.Errorf("dns name %v is excluded by issuer %v", name, issuer.Subject.CommonName)
+		}
+	}
+	for _, ip := range template.IPAddresses {
+		if len(issuer.PermittedIPRanges) > 0 && !matchesAnyRange(ip, issuer.PermittedIPRanges) {
+			return fmt.Errorf("ip address %v is not permitted by issuer %v", ip, issuer.Subject.CommonName)
+		}
+		if matchesAnyRange(ip, issuer.ExcludedIPRanges) {
+			return fmt.Errorf("ip address %v is excluded by issuer %v", ip, issuer.Subject.CommonName)
+		}
+	}
+	return nil
+}
+
+// inheritNameConstraints narrows the name constraints of a sub-CA template to the ones of its issuer.
+// Permitted names of the template have to lie within the permitted names of the issuer,
+// without own permitted names the ones of the issuer are taken. Excluded names are combined.
+func inheritNameConstraints(issuer *x509.Certificate, template *x509.Certificate) error {
+	if len(issuer.PermittedDNSDomains) > 0 {
+		if len(template.PermittedDNSDomains) == 0 {
+			template.PermittedDNSDomains = issuer.PermittedDNSDomains
+		}
+		for _, domain := range template.PermittedDNSDomains {
+			if !containsDomain(issuer.PermittedDNSDomains, domain) && !matchesAnyDomain(strings.TrimPrefix(domain, "."), issuer.PermittedDNSDomains) {
+				return fmt.Errorf("permitted dns domain %v is not permitted by issuer %v", domain, issuer.Subject.CommonName)
+			}
+		}
+	}
+	for _, domain := range issuer.ExcludedDNSDomains {
+		if !containsDomain(template.ExcludedDNSDomains, domain) {
+			template.ExcludedDNSDomains = append(template.ExcludedDNSDomains, domain)
+		}
+	}
+	if len(issuer.PermittedIPRanges) > 0 {
+		if len(template.PermittedIPRanges) == 0 {
+			template.PermittedIPRanges = issuer.PermittedIPRanges
+		}
+		for _, r := range template.PermittedIPRanges {
+			if !withinAnyRange(r, issuer.PermittedIPRanges) {
+				return fmt.Errorf("permitted ip range %v is not permitted by issuer %v", r, issuer.Subject.CommonName)
+			}
+		}
+	}
+	for _, r := range issuer.ExcludedIPRanges {
+		if !withinAnyRange(r, template.ExcludedIPRanges) {
+			template.ExcludedIPRanges = append(template.ExcludedIPRanges, r)
+		}
+	}
+	template.PermittedDNSDomainsCritical = len(template.PermittedDNSDomains) > 0 ||
+		len(template.ExcludedDNSDomains) > 0 ||
+		len(template.PermittedIPRanges) > 0 ||
+		len(template.ExcludedIPRanges) > 0
+	return nil
+}
+
+func containsDomain(domains []string, domain string) bool {
+	for _, d := range domains {
+		if strings.EqualFold(d, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyDomain(name string, constraints []string) bool {
+	for _, constraint := range constraints {
+		if matchDomain(name, constraint) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDomain follows RFC 5280: "example.org" matches the domain itself and
+// all subdomains, ".example.org" matches only subdomains
+func matchDomain(name, constraint string) bool {
+	name = strings.ToLower(name)
+	constraint = strings.ToLower(constraint)
+	if constraint == "" {
+		return true
+	}
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(name, constraint) && len(name) > len(constraint)
+	}
+	return name == constraint || strings.HasSuffix(name, "."+constraint)
+}
+
+// withinAnyRange reports whether r is completely covered by one of ranges
+func withinAnyRange(r *net.IPNet, ranges []*net.IPNet) bool {
+	ones, bits := r.Mask.Size()
+	for _, other := range ranges {
+		otherOnes, otherBits := other.Mask.Size()
+		if bits == otherBits && otherOnes <= ones && other.Contains(r.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyRange(ip net.IP, ranges []*net.IPNet) bool {
+	for _, r := range ranges {
+		if r.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package generator
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"net/url"
+
+	"github.com/trusch/pkid/types"
+)
+
+var (
+	oidExtensionCertificatePolicies = asn1.ObjectIdentifier{2, 5, 29, 32}
+	oidExtensionTLSFeature          = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+	oidPolicyQualifierCPS           = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 1}
+)
+
+// tlsFeatureStatusRequest is the status_request TLS extension (OCSP Must-Staple)
+const tlsFeatureStatusRequest = 5
+
+type policyInformation struct {
+	Policy     asn1.ObjectIdentifier
+	Qualifiers []policyQualifierInfo `asn1:"optional"`
+}
+
+type policyQualifierInfo struct {
+	ID        asn1.ObjectIdentifier
+	Qualifier string `asn1:"ia5"`
+}
+
+// ValidatePolicies checks policy OIDs and CPS URIs
+func ValidatePolicies(policies []types.Policy) error {
+	for _, policy := range policies {
+		if _, err := ParseOID(policy.ID); err != nil {
+			return err
+		}
+		if policy.CPS != "" {
+			if u, err := url.Parse(policy.CPS); err != nil || !u.IsAbs() {
+				return fmt.Errorf("invalid CPS uri %v", policy.CPS)
+			}
+		}
+	}
+	return nil
+}
+
+func certificatePoliciesExtension(policies []types.Policy) (pkix.Extension, error) {
+	infos := make([]policyInformation, len(policies))
+	for idx, policy := range policies {
+		oid, err := ParseOID(policy.ID)
+		if err != nil {
+			return pkix.Extension{}, err
+		}
+		infos[idx].Policy = oid
+		if policy.CPS != "" {
+			infos[idx].Qualifiers = []policyQualifierInfo{{ID: oidPolicyQualifierCPS, Qualifier: policy.CPS}}
+		}
+	}
+	value, err := asn1.Marshal(infos)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{Id: oidExtensionCertificatePolicies, Value: value}, nil
+}
+
+func mustStapleExtension() (pkix.Extension, error) {
+	value, err := asn1.Marshal([]int{tlsFeatureStatusRequest})
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{Id: oidExtensionTLSFeature, Value: value}, nil
+}
+
+// ValidateExtensions checks that custom extensions don't replace the extensions generated by pkid
+// (key usages, constraints, names, key identifiers, CRL and issuer locations) and are unique
+func ValidateExtensions(exts []pkix.Extension) error {
+	seen := map[string]bool{}
+	for _, ext := range exts {
+		if isGeneratedExtension(ext.Id) {
+			return fmt.Errorf("extension %v is generated by pkid and can not be set as custom extension", ext.Id)
+		}
+		if seen[ext.Id.String()] {
+			return fmt.Errorf("extension %v is given more than once", ext.Id)
+		}
+		seen[ext.Id.String()] = true
+	}
+	return nil
+}
+
+// extraExtensions returns the custom extensions together with the policy and TLS feature extensions
+func extraExtensions(options *Options) ([]pkix.Extension, error) {
+	if err := ValidateExtensions(options.ExtraExtensions); err != nil {
+		return nil, err
+	}
+	exts := append([]pkix.Extension{}, options.ExtraExtensions...)
+	if len(options.Policies) > 0 {
+		ext, err := certificatePoliciesExtension(options.Policies)
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, ext)
+	}
+	if options.MustStaple {
+		ext, err := mustStapleExtension()
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, ext)
+	}
+	// custom certificate policy and TLS feature extensions conflict with policies and must-staple
+	if err := ValidateExtensions(exts); err != nil {
+		return nil, err
+	}
+	return exts, nil
+}
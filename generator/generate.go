@@ -4,16 +4,22 @@ package generator
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha1"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"math/big"
+	"net"
+	"net/url"
 	"os"
 	"time"
 
@@ -22,30 +28,132 @@ import (
 )
 
 type Options struct {
-	Name      string
-	NotBefore time.Time
-	ValidFor  time.Duration
-	IsCA      bool
-	RsaBits   int
-	Curve     string
-	Usage     x509.ExtKeyUsage
+	Name           string
+	NotBefore      time.Time
+	ValidFor       time.Duration
+	IsCA           bool
+	KeyType        string
+	RsaBits        int
+	Curve          string
+	Usage          x509.ExtKeyUsage
+	DNSNames       []string
+	IPAddresses    []net.IP
+	EmailAddresses []string
+	URIs           []*url.URL
+	Subject        types.Subject
+	RawSubject     []byte // DER encoded subject, used as is instead of Name and Subject if set
+	PublicKey      crypto.PublicKey
+	Serial         *big.Int // overrides the serial number taken from the CA
+
+	// KeyUsage and ExtKeyUsages override the defaults if set
+	KeyUsage            x509.KeyUsage
+	ExtKeyUsages        []x509.ExtKeyUsage
+	UnknownExtKeyUsages []asn1.ObjectIdentifier
+	Policies            []types.Policy
+	MustStaple          bool
+	ExtraExtensions     []pkix.Extension // must not contain extensions generated from the other options
+
+	// constraints for CA certificates, MaxPathLenZero marks an explicit
+	// path length of 0 as in x509.Certificate
+	MaxPathLen          int
+	MaxPathLenZero      bool
+	PermittedDNSDomains []string
+	ExcludedDNSDomains  []string
+	PermittedIPRanges   []*net.IPNet
+	ExcludedIPRanges    []*net.IPNet
+
+	// revocation and issuer information embedded into the certificate
+	CRLDistributionPoints []string
+	IssuingCertificateURL []string
+	OCSPServer            []string
+
+	// SignatureAlgorithm used by the issuer, defaults to the default of the signing key
+	SignatureAlgorithm x509.SignatureAlgorithm
+
+	// CAConfig is stored with newly created CA's
+	CAConfig types.CAConfig
 }
 
-func (options *Options) fillDefaults() {
+// FillDefaults sets default values for validity, key parameters and usage
+func (options *Options) FillDefaults() {
 	if options.NotBefore.IsZero() {
 		options.NotBefore = time.Now()
 	}
 	if options.ValidFor == 0 {
 		options.ValidFor = 365 * 24 * time.Hour
 	}
-	if options.Curve == "" && options.RsaBits == 0 {
-		options.Curve = "P521"
+	switch options.KeyType {
+	case "":
+		if options.Curve == "" && options.RsaBits == 0 {
+			options.Curve = "P521"
+		}
+	case "rsa":
+		options.Curve = ""
+		if options.RsaBits == 0 {
+			options.RsaBits = 2048
+		}
+	case "ecdsa":
+		if options.Curve == "" {
+			options.Curve = "P521"
+		}
 	}
 	if options.Usage == 0 && !options.IsCA {
 		options.Usage = x509.ExtKeyUsageAny
 	}
 }
 
+// KeyAlgorithm returns the key type (rsa, ecdsa or ed25519) the options will produce
+func (options *Options) KeyAlgorithm() string {
+	switch options.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return "rsa"
+	case *ecdsa.PublicKey:
+		return "ecdsa"
+	case ed25519.PublicKey:
+		return "ed25519"
+	}
+	switch {
+	case options.KeyType != "":
+		return options.KeyType
+	case options.Curve == "" && options.RsaBits != 0:
+		return "rsa"
+	}
+	return "ecdsa"
+}
+
+// ApplyCSR uses the public key of a certificate signing request and
+// takes name, subject and subject alternative names from it unless they are already set
+func (options *Options) ApplyCSR(csr *x509.CertificateRequest) {
+	options.PublicKey = csr.PublicKey
+	if options.Name == "" {
+		options.Name = csr.Subject.CommonName
+	}
+	if len(options.DNSNames) == 0 {
+		options.DNSNames = csr.DNSNames
+	}
+	if len(options.IPAddresses) == 0 {
+		options.IPAddresses = csr.IPAddresses
+	}
+	if len(options.EmailAddresses) == 0 {
+		options.EmailAddresses = csr.EmailAddresses
+	}
+	if len(options.URIs) == 0 {
+		options.URIs = csr.URIs
+	}
+	inheritSubject(&options.Subject, &types.Subject{
+		Organization:       csr.Subject.Organization,
+		OrganizationalUnit: csr.Subject.OrganizationalUnit,
+		Country:            csr.Subject.Country,
+		Province:           csr.Subject.Province,
+		Locality:           csr.Subject.Locality,
+		StreetAddress:      csr.Subject.StreetAddress,
+		PostalCode:         csr.Subject.PostalCode,
+	})
+	if options.Subject.SerialNumber == "" {
+		options.Subject.SerialNumber = csr.Subject.SerialNumber
+	}
+}
+
 func pemBlockForKey(priv interface{}) *pem.Block {
 	switch k := priv.(type) {
 	case *rsa.PrivateKey:
@@ -57,16 +165,31 @@ func pemBlockForKey(priv interface{}) *pem.Block {
 			return nil
 		}
 		return &pem.Block{Type: "EC PRIVATE KEY", Bytes: b}
+	case ed25519.PrivateKey:
+		b, err := x509.MarshalPKCS8PrivateKey(k)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to marshal Ed25519 private key: %v", err)
+			return nil
+		}
+		return &pem.Block{Type: "PRIVATE KEY", Bytes: b}
 	default:
 		return nil
 	}
 }
 
-func generateKey(rsaBits int, curve string) (interface{}, error) {
+func generateKey(keyType string, rsaBits int, curve string) (interface{}, error) {
 	var (
 		priv interface{}
 		err  error
 	)
+	switch keyType {
+	case "", "rsa", "ecdsa":
+	case "ed25519":
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	default:
+		return nil, errors.New("unknown key type (try rsa ecdsa or ed25519)")
+	}
 	switch curve {
 	case "":
 		priv, err = rsa.GenerateKey(rand.Reader, rsaBits)
@@ -113,45 +236,184 @@ func getSignerCertAndKey(template x509.Certificate, priv interface{}, caEntity *
 	return signerCert, signerKey, nil
 }
 
+// KeyIdentifier computes a key identifier as in RFC 5280 4.2.1.2 (1),
+// the SHA-1 hash of the subject public key bit string
+func KeyIdentifier(pub crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	var spki struct {
+		Algorithm        pkix.AlgorithmIdentifier
+		SubjectPublicKey asn1.BitString
+	}
+	if _, err = asn1.Unmarshal(der, &spki); err != nil {
+		return nil, err
+	}
+	hash := sha1.Sum(spki.SubjectPublicKey.Bytes)
+	return hash[:], nil
+}
+
+func inheritSubject(subject *types.Subject, defaults *types.Subject) {
+	if defaults == nil {
+		return
+	}
+	if len(subject.Organization) == 0 {
+		subject.Organization = defaults.Organization
+	}
+	if len(subject.OrganizationalUnit) == 0 {
+		subject.OrganizationalUnit = defaults.OrganizationalUnit
+	}
+	if len(subject.Country) == 0 {
+		subject.Country = defaults.Country
+	}
+	if len(subject.Province) == 0 {
+		subject.Province = defaults.Province
+	}
+	if len(subject.Locality) == 0 {
+		subject.Locality = defaults.Locality
+	}
+	if len(subject.StreetAddress) == 0 {
+		subject.StreetAddress = defaults.StreetAddress
+	}
+	if len(subject.PostalCode) == 0 {
+		subject.PostalCode = defaults.PostalCode
+	}
+}
+
+func subjectName(name string, subject *types.Subject) pkix.Name {
+	return pkix.Name{
+		CommonName:         name,
+		Organization:       subject.Organization,
+		OrganizationalUnit: subject.OrganizationalUnit,
+		Country:            subject.Country,
+		Province:           subject.Province,
+		Locality:           subject.Locality,
+		StreetAddress:      subject.StreetAddress,
+		PostalCode:         subject.PostalCode,
+		SerialNumber:       subject.SerialNumber,
+	}
+}
+
 func publicKey(priv interface{}) interface{} {
 	switch k := priv.(type) {
 	case *rsa.PrivateKey:
 		return &k.PublicKey
 	case *ecdsa.PrivateKey:
 		return &k.PublicKey
+	case ed25519.PrivateKey:
+		return k.Public()
 	default:
 		return nil
 	}
 }
 
 func Generate(ca *types.CAEntity, options *Options) (*types.Entity, error) {
-	options.fillDefaults()
-	priv, err := generateKey(options.RsaBits, options.Curve)
-	if err != nil {
-		return nil, err
+	options.FillDefaults()
+	var (
+		priv interface{}
+		pub  = options.PublicKey
+		err  error
+	)
+	if pub == nil {
+		priv, err = generateKey(options.KeyType, options.RsaBits, options.Curve)
+		if err != nil {
+			return nil, err
+		}
+		pub = publicKey(priv)
+	} else {
+		switch pub.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		default:
+			return nil, errors.New("unsupported public key type")
+		}
+		if ca == nil {
+			return nil, errors.New("can not self-sign a certificate without private key")
+		}
 	}
-	serial, err := getSerial(ca)
-	if err != nil {
-		return nil, err
+	if ca != nil && ca.Key == "" {
+		return nil, errors.New("no private key stored for CA, can not sign")
+	}
+	serial := options.Serial
+	if serial == nil {
+		serial, err = getSerial(ca)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if ca != nil {
+		inheritSubject(&options.Subject, ca.Subject)
 	}
 	template := x509.Certificate{
-		SerialNumber: serial,
-		Subject: pkix.Name{
-			Organization: []string{"Acme Co"},
-			CommonName:   options.Name,
-		},
+		SerialNumber:          serial,
+		Subject:               subjectName(options.Name, &options.Subject),
 		NotBefore:             options.NotBefore,
 		NotAfter:              options.NotBefore.Add(options.ValidFor),
 		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
 		ExtKeyUsage:           []x509.ExtKeyUsage{options.Usage},
 		BasicConstraintsValid: true,
+		DNSNames:              options.DNSNames,
+		IPAddresses:           options.IPAddresses,
+		EmailAddresses:        options.EmailAddresses,
+		URIs:                  options.URIs,
+		CRLDistributionPoints: options.CRLDistributionPoints,
+		IssuingCertificateURL: options.IssuingCertificateURL,
+		OCSPServer:            options.OCSPServer,
+	}
+	template.RawSubject = options.RawSubject
+	template.SubjectKeyId, err = KeyIdentifier(pub)
+	if err != nil {
+		return nil, err
+	}
+	template.ExtraExtensions, err = extraExtensions(options)
+	if err != nil {
+		return nil, err
+	}
+	if options.KeyUsage != 0 {
+		template.KeyUsage = options.KeyUsage
+	}
+	if len(options.ExtKeyUsages) > 0 || len(options.UnknownExtKeyUsages) > 0 {
+		template.ExtKeyUsage = options.ExtKeyUsages
+		template.UnknownExtKeyUsage = options.UnknownExtKeyUsages
+	}
+	if _, ok := pub.(ed25519.PublicKey); ok {
+		template.KeyUsage &^= x509.KeyUsageKeyEncipherment
 	}
 	if options.IsCA {
 		template.IsCA = true
-		template.KeyUsage |= x509.KeyUsageCertSign
+		template.KeyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		template.MaxPathLen = options.MaxPathLen
+		template.MaxPathLenZero = options.MaxPathLenZero
+		template.PermittedDNSDomains = options.PermittedDNSDomains
+		template.ExcludedDNSDomains = options.ExcludedDNSDomains
+		template.PermittedIPRanges = options.PermittedIPRanges
+		template.ExcludedIPRanges = options.ExcludedIPRanges
+		template.PermittedDNSDomainsCritical = len(options.PermittedDNSDomains) > 0 ||
+			len(options.ExcludedDNSDomains) > 0 ||
+			len(options.PermittedIPRanges) > 0 ||
+			len(options.ExcludedIPRanges) > 0
 	}
 	signerCert, signerKey, err := getSignerCertAndKey(template, priv, ca)
-	derBytes, err := x509.CreateCertificate(rand.Reader, &template, signerCert, publicKey(priv), signerKey)
+	if err != nil {
+		return nil, err
+	}
+	if err = CheckSignatureAlgorithm(options.SignatureAlgorithm, publicKey(signerKey)); err != nil {
+		return nil, err
+	}
+	template.SignatureAlgorithm = options.SignatureAlgorithm
+	if ca != nil {
+		if err = checkConstraints(signerCert, &template); err != nil {
+			return nil, err
+		}
+		if len(signerCert.SubjectKeyId) == 0 {
+			// issuers created by older versions have no subject key identifier
+			template.AuthorityKeyId, err = KeyIdentifier(signerCert.PublicKey)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	derBytes, err := x509.CreateCertificate(rand.Reader, &template, signerCert, pub, signerKey)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create certificate: %s", err)
 	}
@@ -160,7 +422,9 @@ func Generate(ca *types.CAEntity, options *Options) (*types.Entity, error) {
 	pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
 
 	keyOut := &bytes.Buffer{}
-	pem.Encode(keyOut, pemBlockForKey(priv))
+	if priv != nil {
+		pem.Encode(keyOut, pemBlockForKey(priv))
+	}
 	entity := &types.Entity{
 		Name: options.Name,
 		Cert: certOut.String(),
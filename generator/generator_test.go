@@ -1,8 +1,15 @@
 package generator
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
 	"math/big"
+	"net"
+	"net/url"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -49,3 +56,213 @@ func TestGenerateSubFoo(t *testing.T) {
 	assert.NotEmpty(t, serverEntity)
 	assert.NoError(t, err)
 }
+
+func TestGenerateWithSubjectAltNames(t *testing.T) {
+	uri, _ := url.Parse("spiffe://example.org/my-server")
+	options := &Options{
+		Name:           "my-server",
+		Usage:          x509.ExtKeyUsageServerAuth,
+		DNSNames:       []string{"example.org", "www.example.org"},
+		IPAddresses:    []net.IP{net.ParseIP("127.0.0.1")},
+		EmailAddresses: []string{"admin@example.org"},
+		URIs:           []*url.URL{uri},
+	}
+	entity, err := Generate(nil, options)
+	assert.NoError(t, err)
+	block, _ := pem.Decode([]byte(entity.Cert))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.org", "www.example.org"}, cert.DNSNames)
+	assert.True(t, cert.IPAddresses[0].Equal(net.ParseIP("127.0.0.1")))
+	assert.Equal(t, []string{"admin@example.org"}, cert.EmailAddresses)
+	assert.Equal(t, uri.String(), cert.URIs[0].String())
+	assert.NoError(t, cert.VerifyHostname("www.example.org"))
+}
+
+func TestGenerateInheritsSubject(t *testing.T) {
+	options := &Options{
+		Name: "my-ca",
+		IsCA: true,
+		Subject: types.Subject{
+			Organization: []string{"My Org"},
+			Country:      []string{"DE"},
+		},
+	}
+	entity, err := Generate(nil, options)
+	assert.NoError(t, err)
+	caEntity := &types.CAEntity{
+		Entity:  entity,
+		Subject: &options.Subject,
+		Serial:  big.NewInt(1),
+	}
+	options = &Options{
+		Name: "my-client",
+		Subject: types.Subject{
+			Country:      []string{"FR"},
+			SerialNumber: "42",
+		},
+	}
+	clientEntity, err := Generate(caEntity, options)
+	assert.NoError(t, err)
+	block, _ := pem.Decode([]byte(clientEntity.Cert))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.NoError(t, err)
+	assert.Equal(t, "my-client", cert.Subject.CommonName)
+	assert.Equal(t, []string{"My Org"}, cert.Subject.Organization)
+	assert.Equal(t, []string{"FR"}, cert.Subject.Country)
+	assert.Equal(t, "42", cert.Subject.SerialNumber)
+}
+
+func TestGenerateEd25519Chain(t *testing.T) {
+	options := &Options{
+		Name:    "my-ca",
+		IsCA:    true,
+		KeyType: "ed25519",
+	}
+	entity, err := Generate(nil, options)
+	assert.NoError(t, err)
+	caEntity := &types.CAEntity{
+		Entity: entity,
+		Serial: big.NewInt(1),
+	}
+	options = &Options{
+		Name:    "my-server",
+		KeyType: "ed25519",
+		Usage:   x509.ExtKeyUsageServerAuth,
+	}
+	serverEntity, err := Generate(caEntity, options)
+	assert.NoError(t, err)
+	block, _ := pem.Decode([]byte(serverEntity.Cert))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.NoError(t, err)
+	assert.Equal(t, x509.Ed25519, cert.PublicKeyAlgorithm)
+	assert.Equal(t, x509.PureEd25519, cert.SignatureAlgorithm)
+	assert.Equal(t, x509.KeyUsageDigitalSignature, cert.KeyUsage)
+}
+
+func TestGenerateUnknownKeyType(t *testing.T) {
+	_, err := Generate(nil, &Options{Name: "my-cert", KeyType: "dsa"})
+	assert.Error(t, err)
+}
+
+func TestGenerateFromPublicKey(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	_, err = Generate(nil, &Options{Name: "my-client", PublicKey: pub})
+	assert.Error(t, err)
+	caEntity, err := Generate(nil, &Options{Name: "my-ca", IsCA: true})
+	assert.NoError(t, err)
+	entity, err := Generate(&types.CAEntity{Entity: caEntity, Serial: big.NewInt(1)}, &Options{Name: "my-client", PublicKey: pub})
+	assert.NoError(t, err)
+	assert.Empty(t, entity.Key)
+	block, _ := pem.Decode([]byte(entity.Cert))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.NoError(t, err)
+	assert.Equal(t, pub, cert.PublicKey)
+}
+
+func TestMatchDomain(t *testing.T) {
+	assert.True(t, matchDomain("team-a.internal", "team-a.internal"))
+	assert.True(t, matchDomain("web.Team-A.internal", "team-a.internal"))
+	assert.True(t, matchDomain("*.team-a.internal", "team-a.internal"))
+	assert.False(t, matchDomain("evilteam-a.internal", "team-a.internal"))
+	assert.False(t, matchDomain("team-a.internal", ".team-a.internal"))
+	assert.True(t, matchDomain("web.team-a.internal", ".team-a.internal"))
+}
+
+func TestGeneratePathLenConstraint(t *testing.T) {
+	root, err := Generate(nil, &Options{Name: "root", IsCA: true, MaxPathLen: 1})
+	assert.NoError(t, err)
+	rootCA := &types.CAEntity{Entity: root, Serial: big.NewInt(1)}
+	_, err = Generate(rootCA, &Options{Name: "sub", IsCA: true, MaxPathLen: 2})
+	assert.Error(t, err)
+	sub, err := Generate(rootCA, &Options{Name: "sub", IsCA: true})
+	assert.NoError(t, err)
+	block, _ := pem.Decode([]byte(sub.Cert))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, cert.MaxPathLen)
+	assert.True(t, cert.MaxPathLenZero)
+}
+
+func TestGenerateInheritsIPConstraints(t *testing.T) {
+	_, permitted, _ := net.ParseCIDR("10.1.0.0/16")
+	_, narrowed, _ := net.ParseCIDR("10.1.2.0/24")
+	_, other, _ := net.ParseCIDR("10.2.0.0/16")
+	root, err := Generate(nil, &Options{Name: "root", IsCA: true})
+	assert.NoError(t, err)
+	rootCA := &types.CAEntity{Entity: root, Serial: big.NewInt(1)}
+	team, err := Generate(rootCA, &Options{Name: "team", IsCA: true, PermittedIPRanges: []*net.IPNet{permitted}})
+	assert.NoError(t, err)
+	teamCA := &types.CAEntity{Entity: team, Serial: big.NewInt(1)}
+	_, err = Generate(teamCA, &Options{Name: "other", IsCA: true, PermittedIPRanges: []*net.IPNet{other}})
+	assert.Error(t, err)
+	_, err = Generate(teamCA, &Options{Name: "narrowed", IsCA: true, PermittedIPRanges: []*net.IPNet{narrowed}})
+	assert.NoError(t, err)
+	sub, err := Generate(teamCA, &Options{Name: "sub", IsCA: true})
+	assert.NoError(t, err)
+	block, _ := pem.Decode([]byte(sub.Cert))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.NoError(t, err)
+	assert.Equal(t, permitted.String(), cert.PermittedIPRanges[0].String())
+	subCA := &types.CAEntity{Entity: sub, Serial: big.NewInt(1)}
+	_, err = Generate(subCA, &Options{Name: "server", IPAddresses: []net.IP{net.ParseIP("10.2.0.1")}})
+	assert.Error(t, err)
+}
+
+func TestGenerateWithPoliciesAndExtensions(t *testing.T) {
+	options := &Options{
+		Name:       "my-client",
+		Policies:   []types.Policy{{ID: "1.3.6.1.4.1.99999.1", CPS: "https://example.org/cps"}, {ID: "2.23.140.1.2.1"}},
+		MustStaple: true,
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 2}, Critical: false, Value: []byte{0x05, 0x00}},
+		},
+	}
+	entity, err := Generate(nil, options)
+	assert.NoError(t, err)
+	block, _ := pem.Decode([]byte(entity.Cert))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.NoError(t, err)
+	assert.Equal(t, []asn1.ObjectIdentifier{{1, 3, 6, 1, 4, 1, 99999, 1}, {2, 23, 140, 1, 2, 1}}, cert.PolicyIdentifiers)
+	found := map[string][]byte{}
+	for _, ext := range cert.Extensions {
+		found[ext.Id.String()] = ext.Value
+	}
+	assert.Equal(t, []byte{0x30, 0x03, 0x02, 0x01, 0x05}, found["1.3.6.1.5.5.7.1.24"])
+	assert.Equal(t, []byte{0x05, 0x00}, found["1.3.6.1.4.1.99999.2"])
+	assert.Contains(t, string(found["2.5.29.32"]), "https://example.org/cps")
+}
+
+func TestGenerateRejectsGeneratedExtensions(t *testing.T) {
+	root, err := Generate(nil, &Options{Name: "root", IsCA: true})
+	assert.NoError(t, err)
+	rootCA := &types.CAEntity{Entity: root, Serial: big.NewInt(1)}
+	for _, oid := range []string{
+		"2.5.29.14",         // subject key identifier
+		"2.5.29.15",         // key usage
+		"2.5.29.17",         // subject alternative names
+		"2.5.29.19",         // basic constraints
+		"2.5.29.30",         // name constraints
+		"2.5.29.31",         // CRL distribution points
+		"2.5.29.35",         // authority key identifier
+		"2.5.29.37",         // extended key usage
+		"1.3.6.1.5.5.7.1.1", // authority information access
+	} {
+		id, err := ParseOID(oid)
+		assert.NoError(t, err)
+		_, err = Generate(rootCA, &Options{Name: "client", ExtraExtensions: []pkix.Extension{{Id: id, Value: []byte{0x05, 0x00}}}})
+		assert.Error(t, err, oid)
+	}
+
+	policies := pkix.Extension{Id: oidExtensionCertificatePolicies, Value: []byte{0x30, 0x00}}
+	_, err = Generate(rootCA, &Options{Name: "client", ExtraExtensions: []pkix.Extension{policies}})
+	assert.NoError(t, err)
+	_, err = Generate(rootCA, &Options{Name: "client", Policies: []types.Policy{{ID: "2.23.140.1.2.1"}}, ExtraExtensions: []pkix.Extension{policies}})
+	assert.Error(t, err)
+	tlsFeature := pkix.Extension{Id: oidExtensionTLSFeature, Value: []byte{0x30, 0x00}}
+	_, err = Generate(rootCA, &Options{Name: "client", ExtraExtensions: []pkix.Extension{tlsFeature}})
+	assert.NoError(t, err)
+	_, err = Generate(rootCA, &Options{Name: "client", MustStaple: true, ExtraExtensions: []pkix.Extension{tlsFeature}})
+	assert.Error(t, err)
+}
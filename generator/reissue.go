@@ -0,0 +1,90 @@
+package generator
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"strings"
+
+	"github.com/trusch/pkid/types"
+)
+
+// extensions x509 generates from the template, all others are taken over as they are
+var generatedExtensions = []asn1.ObjectIdentifier{
+	{2, 5, 29, 14},              // subject key identifier
+	{2, 5, 29, 15},              // key usage
+	{2, 5, 29, 17},              // subject alternative names
+	{2, 5, 29, 19},              // basic constraints
+	{2, 5, 29, 30},              // name constraints
+	{2, 5, 29, 31},              // CRL distribution points
+	{2, 5, 29, 35},              // authority key identifier
+	{2, 5, 29, 37},              // extended key usage
+	{1, 3, 6, 1, 5, 5, 7, 1, 1}, // authority information access
+}
+
+// OptionsFromCertificate returns options which reproduce the exact subject, subject alternative names,
+// usages, constraints and custom extensions of cert. Validity and key are left to the caller.
+func OptionsFromCertificate(cert *x509.Certificate) *Options {
+	options := &Options{
+		Name:           cert.Subject.CommonName,
+		RawSubject:     cert.RawSubject,
+		IsCA:           cert.IsCA,
+		DNSNames:       cert.DNSNames,
+		IPAddresses:    cert.IPAddresses,
+		EmailAddresses: cert.EmailAddresses,
+		URIs:           cert.URIs,
+		Subject: types.Subject{
+			Organization:       cert.Subject.Organization,
+			OrganizationalUnit: cert.Subject.OrganizationalUnit,
+			Country:            cert.Subject.Country,
+			Province:           cert.Subject.Province,
+			Locality:           cert.Subject.Locality,
+			StreetAddress:      cert.Subject.StreetAddress,
+			PostalCode:         cert.Subject.PostalCode,
+			SerialNumber:       cert.Subject.SerialNumber,
+		},
+		KeyUsage:            cert.KeyUsage,
+		ExtKeyUsages:        cert.ExtKeyUsage,
+		MaxPathLen:          cert.MaxPathLen,
+		MaxPathLenZero:      cert.MaxPathLenZero,
+		PermittedDNSDomains: cert.PermittedDNSDomains,
+		ExcludedDNSDomains:  cert.ExcludedDNSDomains,
+		PermittedIPRanges:   cert.PermittedIPRanges,
+		ExcludedIPRanges:    cert.ExcludedIPRanges,
+	}
+	if len(cert.ExtKeyUsage) > 0 {
+		options.Usage = cert.ExtKeyUsage[0]
+	}
+	options.UnknownExtKeyUsages = cert.UnknownExtKeyUsage
+	for _, ext := range cert.Extensions {
+		if !isGeneratedExtension(ext.Id) {
+			options.ExtraExtensions = append(options.ExtraExtensions, ext)
+		}
+	}
+	return options
+}
+
+func isGeneratedExtension(id asn1.ObjectIdentifier) bool {
+	for _, generated := range generatedExtensions {
+		if id.Equal(generated) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetKeyParameters sets KeyType, RsaBits and Curve to generate a key of the same kind as pub
+func (options *Options) SetKeyParameters(pub crypto.PublicKey) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		options.KeyType, options.RsaBits, options.Curve = "rsa", k.N.BitLen(), ""
+	case *ecdsa.PublicKey:
+		options.KeyType, options.RsaBits = "ecdsa", 0
+		options.Curve = strings.Replace(k.Params().Name, "-", "", 1)
+	case ed25519.PublicKey:
+		options.KeyType, options.RsaBits, options.Curve = "ed25519", 0, ""
+	}
+}
@@ -0,0 +1,57 @@
+package generator
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+)
+
+var signatureAlgorithms = []x509.SignatureAlgorithm{
+	x509.SHA256WithRSA,
+	x509.SHA384WithRSA,
+	x509.SHA512WithRSA,
+	x509.SHA256WithRSAPSS,
+	x509.SHA384WithRSAPSS,
+	x509.SHA512WithRSAPSS,
+	x509.ECDSAWithSHA256,
+	x509.ECDSAWithSHA384,
+	x509.ECDSAWithSHA512,
+	x509.PureEd25519,
+}
+
+// ParseSignatureAlgorithm parses names like "SHA384-RSAPSS" or "ECDSA-SHA256",
+// an empty name selects the default algorithm for the signing key
+func ParseSignatureAlgorithm(name string) (x509.SignatureAlgorithm, error) {
+	if name == "" {
+		return x509.UnknownSignatureAlgorithm, nil
+	}
+	for _, algo := range signatureAlgorithms {
+		if algo.String() == name {
+			return algo, nil
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unknown signature algorithm %v", name)
+}
+
+// CheckSignatureAlgorithm checks if a key can produce signatures with the given algorithm
+func CheckSignatureAlgorithm(algo x509.SignatureAlgorithm, pub crypto.PublicKey) error {
+	var ok bool
+	switch algo {
+	case x509.UnknownSignatureAlgorithm:
+		return nil
+	case x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA,
+		x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+		_, ok = pub.(*rsa.PublicKey)
+	case x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512:
+		_, ok = pub.(*ecdsa.PublicKey)
+	case x509.PureEd25519:
+		_, ok = pub.(ed25519.PublicKey)
+	}
+	if !ok {
+		return fmt.Errorf("signature algorithm %v does not match the signing key", algo)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package generator
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/trusch/pkid/entity"
+	"github.com/trusch/pkid/types"
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHOptions describe an OpenSSH certificate for PublicKey.
+// CertType is "user" (default) or "host", user certificates get the default
+// extensions of ssh-keygen if Extensions is nil.
+type SSHOptions struct {
+	PublicKey       ssh.PublicKey
+	KeyID           string
+	CertType        string
+	Principals      []string
+	ValidAfter      time.Time
+	ValidFor        time.Duration
+	CriticalOptions map[string]string
+	Extensions      map[string]string
+	Serial          uint64
+}
+
+var defaultSSHUserExtensions = map[string]string{
+	"permit-X11-forwarding":   "",
+	"permit-agent-forwarding": "",
+	"permit-port-forwarding":  "",
+	"permit-pty":              "",
+	"permit-user-rc":          "",
+}
+
+// NewSSHSigner returns a ssh signer using the key of the CA
+func NewSSHSigner(ca *types.CAEntity) (ssh.Signer, error) {
+	if ca.Key == "" {
+		return nil, errors.New("CA has no private key")
+	}
+	key, err := entity.ParsePrivateKeyPEM([]byte(ca.Key))
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewSignerFromKey(key)
+}
+
+// GenerateSSHCertificate signs an OpenSSH certificate with the key of the CA
+func GenerateSSHCertificate(ca *types.CAEntity, options *SSHOptions) (*ssh.Certificate, error) {
+	if options.PublicKey == nil {
+		return nil, errors.New("no public key given")
+	}
+	if options.KeyID == "" {
+		return nil, errors.New("no key id given")
+	}
+	// OpenSSH accepts certificates without principals for every user or host
+	if len(options.Principals) == 0 {
+		return nil, errors.New("no principals given")
+	}
+	cert := &ssh.Certificate{
+		Key:             options.PublicKey,
+		Serial:          options.Serial,
+		KeyId:           options.KeyID,
+		ValidPrincipals: options.Principals,
+		ValidAfter:      uint64(options.ValidAfter.Unix()),
+		ValidBefore:     uint64(options.ValidAfter.Add(options.ValidFor).Unix()),
+		Permissions: ssh.Permissions{
+			CriticalOptions: options.CriticalOptions,
+			Extensions:      options.Extensions,
+		},
+	}
+	switch options.CertType {
+	case "", "user":
+		cert.CertType = ssh.UserCert
+		if cert.Extensions == nil {
+			cert.Extensions = make(map[string]string)
+			for name, value := range defaultSSHUserExtensions {
+				cert.Extensions[name] = value
+			}
+		}
+	case "host":
+		cert.CertType = ssh.HostCert
+		if len(cert.CriticalOptions) > 0 || len(cert.Extensions) > 0 {
+			return nil, errors.New("host certificates have no critical options or extensions")
+		}
+	default:
+		return nil, fmt.Errorf("unknown ssh certificate type %v (try user or host)", options.CertType)
+	}
+	signer, err := NewSSHSigner(ca)
+	if err != nil {
+		return nil, err
+	}
+	if err = cert.SignCert(rand.Reader, signer); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
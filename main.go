@@ -12,6 +12,8 @@ import (
 var storagePath = flag.String("storage", "leveldb:///usr/share/pkid/datastore", "storage backend uri")
 var listenAddr = flag.String("listen", ":80", "listen address")
 var token = flag.String("token", "", "bearer authorization token for secure storaged backend")
+var requireEncryptedKeys = flag.Bool("require-encrypted-keys", false, "only allow private key downloads encrypted with a passphrase")
+var baseURL = flag.String("base-url", "", "public base url of this service (example: https://pki.example.org), embedded into issued certificates as CRL and issuer location")
 
 func main() {
 	flag.Parse()
@@ -19,7 +21,8 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	mgr := manager.NewThreadSafeManager(store)
+	mgr := manager.NewThreadSafeManager(store, *baseURL)
 	srv := server.New(*listenAddr, mgr)
+	srv.RequireEncryptedKeys = *requireEncryptedKeys
 	log.Fatal(srv.ListenAndServe())
 }
@@ -1,13 +1,12 @@
 package manager
 
 import (
-	"bytes"
-	"crypto/rand"
 	"crypto/x509"
-	"crypto/x509/pkix"
-	"encoding/pem"
+	"errors"
+	"fmt"
 	"math/big"
-	"time"
+	"sort"
+	"strings"
 
 	"github.com/trusch/pkid/entity"
 	"github.com/trusch/pkid/generator"
@@ -16,11 +15,22 @@ import (
 )
 
 type BasicManager struct {
-	store storage.Storage
+	store   storage.Storage
+	baseURL string
 }
 
-func NewBasicManager(store storage.Storage) Manager {
-	return &BasicManager{store}
+// NewBasicManager returns a new manager, the optional base URL is the public URL of pkid
+// which is used to point issued certificates to the CRL and certificate of their issuer
+func NewBasicManager(store storage.Storage, baseURL ...string) Manager {
+	return newBasicManager(store, baseURL...)
+}
+
+func newBasicManager(store storage.Storage, baseURL ...string) *BasicManager {
+	mgr := &BasicManager{store: store}
+	if len(baseURL) > 0 {
+		mgr.baseURL = strings.TrimSuffix(baseURL[0], "/")
+	}
+	return mgr
 }
 
 func (mgr *BasicManager) GetCA(id string) (*types.CAEntity, error) {
@@ -35,27 +45,115 @@ func (mgr *BasicManager) GetServer(id string) (*types.Entity, error) {
 	return mgr.store.LoadServer(id)
 }
 
+func (mgr *BasicManager) GetIssued(id string) (*types.Entity, error) {
+	return mgr.store.LoadIssued(id)
+}
+
+func (mgr *BasicManager) GetProfile(name string) (*types.Profile, error) {
+	profile, err := mgr.store.LoadProfile(name)
+	if err == nil {
+		return profile, nil
+	}
+	if builtin, ok := builtinProfiles[name]; ok {
+		return builtin, nil
+	}
+	return nil, fmt.Errorf("unknown profile %v", name)
+}
+
+func (mgr *BasicManager) ListProfiles() ([]string, error) {
+	names, err := mgr.store.ListProfiles()
+	if err != nil {
+		return nil, err
+	}
+	for name := range builtinProfiles {
+		found := false
+		for _, n := range names {
+			if n == name {
+				found = true
+			}
+		}
+		if !found {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (mgr *BasicManager) SaveProfile(profile *types.Profile) error {
+	if err := validateProfile(profile); err != nil {
+		return err
+	}
+	return mgr.store.SaveProfile(profile)
+}
+
+func (mgr *BasicManager) DeleteProfile(name string) error {
+	if _, err := mgr.store.LoadProfile(name); err != nil {
+		return fmt.Errorf("no stored profile %v", name)
+	}
+	return mgr.store.DeleteProfile(name)
+}
+
+func (mgr *BasicManager) UpdateCAConfig(caID string, config *types.CAConfig) error {
+	ca, err := mgr.GetCA(caID)
+	if err != nil {
+		return err
+	}
+	if ca.Imported {
+		if err = importedSerialStrategy(config); err != nil {
+			return err
+		}
+	}
+	if err = validateCAConfig(config); err != nil {
+		return err
+	}
+	algo, _ := generator.ParseSignatureAlgorithm(config.SignatureAlgorithm)
+	cert, err := entity.ParseCertificatePEM([]byte(ca.Cert))
+	if err != nil {
+		return err
+	}
+	if err = generator.CheckSignatureAlgorithm(algo, cert.PublicKey); err != nil {
+		return err
+	}
+	ca.Config = *config
+	// the cached CRL's may have been signed with other settings
+	ca.CRLs.Base, ca.CRLs.Delta = "", ""
+	return mgr.store.SaveCA(ca)
+}
+
 func (mgr *BasicManager) CreateCA(caID string, options *generator.Options) (string, error) {
 	ca, _ := mgr.store.LoadCA(caID)
 	options.IsCA = true
-	entity, err := generator.Generate(ca, options)
+	if err := validateCAConfig(&options.CAConfig); err != nil {
+		return "", err
+	}
+	entity, err := mgr.sign(ca, options)
 	if err != nil {
 		return "", err
 	}
-	entity.ID = mgr.store.GetID()
 
-	newCaEntity := &types.CAEntity{Entity: entity, Serial: big.NewInt(1)}
+	subject := options.Subject
+	subject.SerialNumber = ""
+	newCaEntity := &types.CAEntity{
+		Entity:         entity,
+		Subject:        &subject,
+		Config:         options.CAConfig,
+		Serial:         big.NewInt(1),
+		SerialsIndexed: true,
+	}
+	if ca != nil {
+		newCaEntity.Parent = ca.ID
+	}
 	err = mgr.store.SaveCA(newCaEntity)
 	if err != nil {
 		return "", err
 	}
 	if ca != nil {
-		ca.Serial.Add(ca.Serial, big.NewInt(1))
 		if ca.CAs == nil {
 			ca.CAs = make(map[string]string)
 		}
 		ca.CAs[newCaEntity.ID] = newCaEntity.Name
-		err = mgr.store.SaveCA(ca)
+		err = mgr.register(ca, entity)
 		if err != nil {
 			return "", err
 		}
@@ -66,22 +164,20 @@ func (mgr *BasicManager) CreateCA(caID string, options *generator.Options) (stri
 func (mgr *BasicManager) CreateClient(caID string, options *generator.Options) (string, error) {
 	ca, _ := mgr.store.LoadCA(caID)
 	options.Usage = x509.ExtKeyUsageClientAuth
-	entity, err := generator.Generate(ca, options)
+	entity, err := mgr.sign(ca, options)
 	if err != nil {
 		return "", err
 	}
-	entity.ID = mgr.store.GetID()
 	err = mgr.store.SaveClient(entity)
 	if err != nil {
 		return "", err
 	}
 	if ca != nil {
-		ca.Serial.Add(ca.Serial, big.NewInt(1))
 		if ca.Clients == nil {
 			ca.Clients = make(map[string]string)
 		}
 		ca.Clients[entity.ID] = entity.Name
-		err = mgr.store.SaveCA(ca)
+		err = mgr.register(ca, entity)
 		if err != nil {
 			return "", err
 		}
@@ -92,22 +188,20 @@ func (mgr *BasicManager) CreateClient(caID string, options *generator.Options) (
 func (mgr *BasicManager) CreateServer(caID string, options *generator.Options) (string, error) {
 	ca, _ := mgr.store.LoadCA(caID)
 	options.Usage = x509.ExtKeyUsageServerAuth
-	entity, err := generator.Generate(ca, options)
+	entity, err := mgr.sign(ca, options)
 	if err != nil {
 		return "", err
 	}
-	entity.ID = mgr.store.GetID()
 	err = mgr.store.SaveServer(entity)
 	if err != nil {
 		return "", err
 	}
 	if ca != nil {
-		ca.Serial.Add(ca.Serial, big.NewInt(1))
 		if ca.Servers == nil {
 			ca.Servers = make(map[string]string)
 		}
 		ca.Servers[entity.ID] = entity.Name
-		err = mgr.store.SaveCA(ca)
+		err = mgr.register(ca, entity)
 		if err != nil {
 			return "", err
 		}
@@ -115,105 +209,131 @@ func (mgr *BasicManager) CreateServer(caID string, options *generator.Options) (
 	return entity.ID, nil
 }
 
-func (mgr *BasicManager) RevokeCA(caID, id string) error {
-	ca, err := mgr.GetCA(caID)
+func (mgr *BasicManager) Issue(caID, profileName string, options *generator.Options) (string, error) {
+	ca, err := mgr.store.LoadCA(caID)
 	if err != nil {
-		return err
+		return "", err
 	}
-	subCa, err := mgr.GetCA(id)
+	profile, err := mgr.GetProfile(profileName)
 	if err != nil {
-		return err
+		return "", err
 	}
-	serial, err := mgr.getSerialFromEntity(subCa.Entity)
-	if err != nil {
-		return err
+	if err = applyProfile(profile, options); err != nil {
+		return "", err
 	}
-	subCa.IsRevoked = true
-	err = mgr.store.SaveCA(subCa)
+	entity, err := mgr.sign(ca, options)
 	if err != nil {
-		return err
-	}
-	ca.Revoked = append(ca.Revoked, serial)
-	return mgr.store.SaveCA(ca)
-}
-
-func (mgr *BasicManager) RevokeClient(caID, id string) error {
-	ca, err := mgr.GetCA(caID)
-	if err != nil {
-		return err
+		return "", err
 	}
-	client, err := mgr.GetClient(id)
+	entity.Profile = profile.Name
+	err = mgr.store.SaveIssued(entity)
 	if err != nil {
-		return err
+		return "", err
 	}
-	serial, err := mgr.getSerialFromEntity(client)
-	if err != nil {
-		return err
+	if ca.Issued == nil {
+		ca.Issued = make(map[string]string)
 	}
-	client.IsRevoked = true
-	err = mgr.store.SaveClient(client)
+	ca.Issued[entity.ID] = entity.Name
+	err = mgr.register(ca, entity)
 	if err != nil {
-		return err
+		return "", err
 	}
-	ca.Revoked = append(ca.Revoked, serial)
-	return mgr.store.SaveCA(ca)
+	return entity.ID, nil
 }
 
-func (mgr *BasicManager) RevokeServer(caID, id string) error {
-	ca, err := mgr.GetCA(caID)
-	if err != nil {
-		return err
+// sign creates a new entity signed by ca (self signed if ca is nil).
+// The serial number is reserved and saved in the CA before signing,
+// so a failure later on can never lead to a reused serial.
+func (mgr *BasicManager) sign(ca *types.CAEntity, options *generator.Options) (*types.Entity, error) {
+	if ca != nil && ca.IsRevoked {
+		return nil, errors.New("the CA is revoked and can not issue certificates")
 	}
-	server, err := mgr.GetServer(id)
-	if err != nil {
-		return err
+	if err := applyValidityPolicy(ca, options); err != nil {
+		return nil, err
+	}
+	config := &options.CAConfig
+	if ca != nil {
+		config = &ca.Config
 	}
-	serial, err := mgr.getSerialFromEntity(server)
+	algo, err := generator.ParseSignatureAlgorithm(config.SignatureAlgorithm)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	options.SignatureAlgorithm = algo
+	if ca != nil {
+		serial, err := mgr.nextSerial(ca)
+		if err != nil {
+			return nil, err
+		}
+		options.Serial = serial
+		if err = mgr.store.SaveCA(ca); err != nil {
+			return nil, err
+		}
+		mgr.setIssuerURLs(ca, options)
 	}
-	server.IsRevoked = true
-	err = mgr.store.SaveServer(server)
+	entity, err := generator.Generate(ca, options)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	ca.Revoked = append(ca.Revoked, serial)
-	return mgr.store.SaveCA(ca)
+	entity.ID = mgr.store.GetID()
+	return entity, nil
 }
 
-func (mgr *BasicManager) GetCRL(caID string) (string, error) {
-	caEntity, err := mgr.GetCA(caID)
-	if err != nil {
-		return "", err
-	}
-	revokedCerts := make([]pkix.RevokedCertificate, len(caEntity.Revoked))
-	now := time.Now()
-	for idx, serial := range caEntity.Revoked {
-		revokedCerts[idx] = pkix.RevokedCertificate{
-			SerialNumber:   serial,
-			RevocationTime: now,
+// setIssuerURLs points the certificate to the CRL, certificate and OCSP responder of its issuer,
+// RFC 5280 requires DER encoding for the CRL and issuer certificate behind these URLs
+func (mgr *BasicManager) setIssuerURLs(ca *types.CAEntity, options *generator.Options) {
+	crlURL, issuerURL := ca.Config.CRLURL, ca.Config.IssuerURL
+	if mgr.baseURL != "" {
+		if crlURL == "" {
+			crlURL = fmt.Sprintf("%v/ca/%v/crl?format=der", mgr.baseURL, ca.ID)
+		}
+		if issuerURL == "" {
+			issuerURL = fmt.Sprintf("%v/ca/%v/cert?format=der", mgr.baseURL, ca.ID)
 		}
 	}
-	entity, err := entity.NewEntityFromPEM([]byte(caEntity.Cert), []byte(caEntity.Key))
-	if err != nil {
-		return "", err
+	if crlURL != "" {
+		options.CRLDistributionPoints = []string{crlURL}
 	}
-	derCRL, err := entity.Cert.CreateCRL(rand.Reader, entity.Key, revokedCerts, now, now.Add(365*24*time.Hour))
-	if err != nil {
-		return "", err
+	if issuerURL != "" {
+		options.IssuingCertificateURL = []string{issuerURL}
+	}
+	if ca.Config.OCSPURL != "" {
+		options.OCSPServer = []string{ca.Config.OCSPURL}
 	}
-	out := &bytes.Buffer{}
-	err = pem.Encode(out, &pem.Block{Type: "X509 CRL", Bytes: derCRL})
+}
+
+// register saves the CA after a child has been added and indexes the serial of the child
+func (mgr *BasicManager) register(ca *types.CAEntity, e *types.Entity) error {
+	if err := mgr.store.SaveCA(ca); err != nil {
+		return err
+	}
+	serial, err := mgr.getSerialFromEntity(e)
 	if err != nil {
-		return "", err
+		return err
 	}
-	return out.String(), nil
+	return mgr.store.SaveSerial(ca.ID, serial, e.ID)
+}
+
+func (mgr *BasicManager) RevokeCA(caID, id string) error {
+	return mgr.Revoke(caID, types.CA, id, nil)
+}
+
+func (mgr *BasicManager) RevokeClient(caID, id string) error {
+	return mgr.Revoke(caID, types.Client, id, nil)
+}
+
+func (mgr *BasicManager) RevokeServer(caID, id string) error {
+	return mgr.Revoke(caID, types.Server, id, nil)
+}
+
+func (mgr *BasicManager) RevokeIssued(caID, id string) error {
+	return mgr.Revoke(caID, types.Issued, id, nil)
 }
 
 func (mgr *BasicManager) getSerialFromEntity(e *types.Entity) (*big.Int, error) {
-	parsed, err := entity.NewEntityFromPEM([]byte(e.Cert), []byte(e.Key))
+	cert, err := entity.ParseCertificatePEM([]byte(e.Cert))
 	if err != nil {
 		return nil, err
 	}
-	return parsed.Cert.SerialNumber, nil
+	return cert.SerialNumber, nil
 }
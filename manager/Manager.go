@@ -1,6 +1,7 @@
 package manager
 
 import (
+	"github.com/trusch/pkid/entity"
 	"github.com/trusch/pkid/generator"
 	"github.com/trusch/pkid/types"
 )
@@ -10,10 +11,37 @@ type Manager interface {
 	GetClient(id string) (*types.Entity, error)
 	GetServer(id string) (*types.Entity, error)
 	CreateCA(caID string, options *generator.Options) (string, error)
+	UpdateCAConfig(caID string, config *types.CAConfig) error
 	CreateClient(caID string, options *generator.Options) (string, error)
 	CreateServer(caID string, options *generator.Options) (string, error)
 	RevokeCA(caID, id string) error
+	RevokeCACascading(caID, id string, revocation *types.Revocation) error
+	Revoke(caID string, typ types.EntityType, id string, revocation *types.Revocation) error
 	RevokeClient(caID, id string) error
 	RevokeServer(caID, id string) error
 	GetCRL(caID string) (string, error)
+	GetDeltaCRL(caID string) (string, error)
+	GetIssued(id string) (*types.Entity, error)
+	Issue(caID, profile string, options *generator.Options) (string, error)
+	RevokeIssued(caID, id string) error
+	GetProfile(name string) (*types.Profile, error)
+	ListProfiles() ([]string, error)
+	SaveProfile(profile *types.Profile) error
+	DeleteProfile(name string) error
+	Renew(caID string, typ types.EntityType, id string, options *generator.Options, revokeOld bool) error
+	Rekey(caID string, typ types.EntityType, id string, options *generator.Options, revokeOld bool) error
+	CrossSign(caID, otherCaID string, options *generator.Options) (string, error)
+	RevokeCrossCert(caID, otherCaID string, revocation *types.Revocation) error
+	ImportCA(parentID string, certPEM, keyPEM []byte, config *types.CAConfig) (string, error)
+	ImportCertificate(caID string, typ types.EntityType, certPEM, keyPEM []byte) (string, error)
+	GetPKCS12(caID string, typ types.EntityType, id, password string, legacy bool) ([]byte, error)
+	GetChain(caID string, typ types.EntityType, id string, includeRoot bool) (string, error)
+	GetBundle(caID string) (string, error)
+	GetJWK(caID string, typ types.EntityType, id string) (*entity.JWK, error)
+	GetJWKS(caID string) (*entity.JWKSet, error)
+	GetSSHPublicKey(caID string) (string, error)
+	SignSSHKey(caID string, options *generator.SSHOptions) (string, error)
+	GetSSHCert(caID, id string) (*types.SSHCert, error)
+	RevokeSSHCert(caID, id string) error
+	GetKRL(caID string) ([]byte, error)
 }
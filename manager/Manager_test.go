@@ -1,13 +1,27 @@
 package manager
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"io/ioutil"
 	"math/big"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"github.com/trusch/pkid/entity"
 	"github.com/trusch/pkid/generator"
 	"github.com/trusch/pkid/storage"
+	"github.com/trusch/pkid/types"
+	"golang.org/x/crypto/ssh"
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
 )
 
 type ManagerSuite struct {
@@ -99,13 +113,807 @@ func (suite *ManagerSuite) TestRevoke() {
 
 	ca, err := suite.manager.GetCA(rootCaID)
 	suite.NoError(err)
-	suite.Equal([]*big.Int{big.NewInt(1), big.NewInt(2), big.NewInt(3)}, ca.Revoked)
+	suite.Equal([]*big.Int{big.NewInt(1), big.NewInt(2), big.NewInt(3)}, revokedSerials(ca))
 
 	crl, err := suite.manager.GetCRL(rootCaID)
 	suite.NoError(err)
 	suite.NotEmpty(crl)
 }
 
+func (suite *ManagerSuite) TestEd25519() {
+	rootCaID, err := suite.manager.CreateCA("", &generator.Options{Name: "root-ca", KeyType: "ed25519"})
+	suite.NoError(err)
+	caID, err := suite.manager.CreateCA(rootCaID, &generator.Options{Name: "my-ca", KeyType: "ed25519"})
+	suite.NoError(err)
+	clientID, err := suite.manager.CreateClient(caID, &generator.Options{Name: "my-client", KeyType: "ed25519"})
+	suite.NoError(err)
+	err = suite.manager.RevokeClient(caID, clientID)
+	suite.NoError(err)
+	crl, err := suite.manager.GetCRL(caID)
+	suite.NoError(err)
+	suite.NotEmpty(crl)
+}
+
+func (suite *ManagerSuite) TestConstrainedSubCA() {
+	rootCaID, err := suite.manager.CreateCA("", &generator.Options{Name: "root-ca"})
+	suite.NoError(err)
+	caID, err := suite.manager.CreateCA(rootCaID, &generator.Options{
+		Name:                "team-a",
+		MaxPathLen:          0,
+		MaxPathLenZero:      true,
+		PermittedDNSDomains: []string{"team-a.internal"},
+	})
+	suite.NoError(err)
+	_, err = suite.manager.CreateServer(caID, &generator.Options{Name: "web", DNSNames: []string{"web.team-a.internal"}})
+	suite.NoError(err)
+	_, err = suite.manager.CreateServer(caID, &generator.Options{Name: "web", DNSNames: []string{"web.team-b.internal"}})
+	suite.Error(err)
+	_, err = suite.manager.CreateCA(caID, &generator.Options{Name: "sub-team-a"})
+	suite.Error(err)
+}
+
+func (suite *ManagerSuite) TestConstrainedSubCAChain() {
+	rootCaID, err := suite.manager.CreateCA("", &generator.Options{Name: "root-ca"})
+	suite.NoError(err)
+	teamCaID, err := suite.manager.CreateCA(rootCaID, &generator.Options{
+		Name:                "team-a",
+		PermittedDNSDomains: []string{"team-a.internal"},
+		ExcludedDNSDomains:  []string{"secret.team-a.internal"},
+	})
+	suite.NoError(err)
+	_, err = suite.manager.CreateCA(teamCaID, &generator.Options{Name: "team-b", PermittedDNSDomains: []string{"team-b.internal"}})
+	suite.Error(err)
+	subCaID, err := suite.manager.CreateCA(teamCaID, &generator.Options{Name: "sub-team-a"})
+	suite.NoError(err)
+
+	_, err = suite.manager.CreateServer(subCaID, &generator.Options{Name: "google", DNSNames: []string{"www.google.com"}})
+	suite.Error(err)
+	_, err = suite.manager.CreateServer(subCaID, &generator.Options{Name: "secret", DNSNames: []string{"db.secret.team-a.internal"}})
+	suite.Error(err)
+	serverID, err := suite.manager.CreateServer(subCaID, &generator.Options{Name: "web", DNSNames: []string{"web.team-a.internal"}})
+	suite.NoError(err)
+
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	for id, pool := range map[string]*x509.CertPool{rootCaID: roots, teamCaID: intermediates, subCaID: intermediates} {
+		ca, err := suite.manager.GetCA(id)
+		suite.NoError(err)
+		cert, err := entity.ParseCertificatePEM([]byte(ca.Cert))
+		suite.NoError(err)
+		pool.AddCert(cert)
+	}
+	server, err := suite.manager.GetServer(serverID)
+	suite.NoError(err)
+	serverCert, err := entity.ParseCertificatePEM([]byte(server.Cert))
+	suite.NoError(err)
+	_, err = serverCert.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, DNSName: "web.team-a.internal"})
+	suite.NoError(err)
+}
+
+func (suite *ManagerSuite) TestIssueWithProfile() {
+	rootCaID, err := suite.manager.CreateCA("", &generator.Options{Name: "root-ca"})
+	suite.NoError(err)
+	err = suite.manager.SaveProfile(&types.Profile{
+		Name:          "short-lived-peer",
+		KeyUsage:      []string{"digitalSignature"},
+		ExtKeyUsage:   []string{"serverAuth", "clientAuth"},
+		KeyAlgorithms: []string{"ed25519"},
+		MaxValidity:   "24h",
+	})
+	suite.NoError(err)
+	_, err = suite.manager.Issue(rootCaID, "short-lived-peer", &generator.Options{Name: "peer", KeyType: "rsa"})
+	suite.Error(err)
+	_, err = suite.manager.Issue(rootCaID, "short-lived-peer", &generator.Options{Name: "peer", KeyType: "ed25519", ValidFor: 48 * time.Hour})
+	suite.Error(err)
+	id, err := suite.manager.Issue(rootCaID, "short-lived-peer", &generator.Options{Name: "peer", KeyType: "ed25519"})
+	suite.NoError(err)
+	issued, err := suite.manager.GetIssued(id)
+	suite.NoError(err)
+	suite.Equal("short-lived-peer", issued.Profile)
+	cert, err := entity.ParseCertificatePEM([]byte(issued.Cert))
+	suite.NoError(err)
+	suite.Equal([]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}, cert.ExtKeyUsage)
+	suite.Equal(24*time.Hour, cert.NotAfter.Sub(cert.NotBefore))
+	_, err = suite.manager.Issue(rootCaID, "ocsp-signer", &generator.Options{Name: "ocsp"})
+	suite.NoError(err)
+	err = suite.manager.RevokeIssued(rootCaID, id)
+	suite.NoError(err)
+	names, err := suite.manager.ListProfiles()
+	suite.NoError(err)
+	suite.Contains(names, "short-lived-peer")
+	suite.Contains(names, "web-server")
+	suite.NoError(suite.manager.DeleteProfile("short-lived-peer"))
+	suite.Error(suite.manager.DeleteProfile("web-server"))
+	suite.Error(suite.manager.SaveProfile(&types.Profile{Name: "broken", ExtKeyUsage: []string{"coffeeMaking"}}))
+	suite.Error(suite.manager.SaveProfile(&types.Profile{Name: "broken", Extensions: []types.Extension{{ID: "2.5.29.37", Value: []byte{0x30, 0x00}}}}))
+}
+
+func (suite *ManagerSuite) TestCustomExtensionsCanNotOverrideCA() {
+	rootCaID, err := suite.manager.CreateCA("", &generator.Options{Name: "root-ca", MaxPathLen: 0, MaxPathLenZero: true})
+	suite.NoError(err)
+	basicConstraints, err := asn1.Marshal(struct {
+		IsCA bool `asn1:"optional"`
+	}{true})
+	suite.NoError(err)
+	_, err = suite.manager.CreateClient(rootCaID, &generator.Options{
+		Name:            "my-client",
+		ExtraExtensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{2, 5, 29, 19}, Critical: true, Value: basicConstraints}},
+	})
+	suite.Error(err)
+	codeSigning, err := asn1.Marshal([]asn1.ObjectIdentifier{{1, 3, 6, 1, 5, 5, 7, 3, 3}})
+	suite.NoError(err)
+	_, err = suite.manager.Issue(rootCaID, "web-server", &generator.Options{
+		Name:            "www",
+		DNSNames:        []string{"www.example.org"},
+		ExtraExtensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{2, 5, 29, 37}, Value: codeSigning}},
+	})
+	suite.Error(err)
+	_, err = suite.manager.Issue(rootCaID, "web-server", &generator.Options{
+		Name:            "www",
+		DNSNames:        []string{"www.example.org"},
+		ExtraExtensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 2}, Value: []byte{0x05, 0x00}}},
+	})
+	suite.Error(err)
+	_, err = suite.manager.Issue(rootCaID, "web-server", &generator.Options{Name: "www", DNSNames: []string{"www.example.org"}})
+	suite.NoError(err)
+}
+
+func (suite *ManagerSuite) TestValidityPolicy() {
+	rootCaID, err := suite.manager.CreateCA("", &generator.Options{Name: "root-ca", ValidFor: 48 * time.Hour})
+	suite.NoError(err)
+	root, err := suite.manager.GetCA(rootCaID)
+	suite.NoError(err)
+	rootCert, err := entity.ParseCertificatePEM([]byte(root.Cert))
+	suite.NoError(err)
+
+	caID, err := suite.manager.CreateCA(rootCaID, &generator.Options{Name: "my-ca", ValidFor: 720 * time.Hour})
+	suite.NoError(err)
+	ca, err := suite.manager.GetCA(caID)
+	suite.NoError(err)
+	caCert, err := entity.ParseCertificatePEM([]byte(ca.Cert))
+	suite.NoError(err)
+	suite.Equal(rootCert.NotAfter, caCert.NotAfter)
+
+	err = suite.manager.UpdateCAConfig(rootCaID, &types.CAConfig{ValidityPolicy: "reject", MaxValidFor: "24h", MaxBackdate: "1h"})
+	suite.NoError(err)
+	_, err = suite.manager.CreateClient(rootCaID, &generator.Options{Name: "my-client", ValidFor: 25 * time.Hour})
+	suite.Error(err)
+	_, err = suite.manager.CreateClient(rootCaID, &generator.Options{Name: "my-client", NotBefore: time.Now().Add(-2 * time.Hour), ValidFor: time.Hour})
+	suite.Error(err)
+	_, err = suite.manager.CreateClient(rootCaID, &generator.Options{Name: "my-client", ValidFor: 12 * time.Hour})
+	suite.NoError(err)
+
+	err = suite.manager.UpdateCAConfig(rootCaID, &types.CAConfig{ValidityPolicy: "clamp", MaxValidFor: "24h"})
+	suite.NoError(err)
+	serverID, err := suite.manager.CreateServer(rootCaID, &generator.Options{Name: "my-server", ValidFor: 720 * time.Hour})
+	suite.NoError(err)
+	server, err := suite.manager.GetServer(serverID)
+	suite.NoError(err)
+	serverCert, err := entity.ParseCertificatePEM([]byte(server.Cert))
+	suite.NoError(err)
+	suite.Equal(24*time.Hour, serverCert.NotAfter.Sub(serverCert.NotBefore))
+
+	suite.Error(suite.manager.UpdateCAConfig(rootCaID, &types.CAConfig{ValidityPolicy: "ignore"}))
+}
+
+func (suite *ManagerSuite) TestRandomSerials() {
+	rootCaID, err := suite.manager.CreateCA("", &generator.Options{
+		Name:     "root-ca",
+		CAConfig: types.CAConfig{SerialStrategy: "random"},
+	})
+	suite.NoError(err)
+	serials := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		clientID, err := suite.manager.CreateClient(rootCaID, &generator.Options{Name: "my-client"})
+		suite.NoError(err)
+		client, err := suite.manager.GetClient(clientID)
+		suite.NoError(err)
+		cert, err := entity.ParseCertificatePEM([]byte(client.Cert))
+		suite.NoError(err)
+		suite.True(cert.SerialNumber.BitLen() > 64)
+		serials[cert.SerialNumber.String()] = true
+	}
+	suite.Equal(3, len(serials))
+	_, err = suite.manager.CreateCA("", &generator.Options{Name: "root-ca", CAConfig: types.CAConfig{SerialStrategy: "guess"}})
+	suite.Error(err)
+}
+
+func (suite *ManagerSuite) TestSignatureAlgorithm() {
+	rootCaID, err := suite.manager.CreateCA("", &generator.Options{
+		Name:     "root-ca",
+		KeyType:  "rsa",
+		CAConfig: types.CAConfig{SignatureAlgorithm: "SHA384-RSAPSS"},
+	})
+	suite.NoError(err)
+	ca, err := suite.manager.GetCA(rootCaID)
+	suite.NoError(err)
+	caCert, err := entity.ParseCertificatePEM([]byte(ca.Cert))
+	suite.NoError(err)
+	suite.Equal(x509.SHA384WithRSAPSS, caCert.SignatureAlgorithm)
+	suite.NotZero(caCert.KeyUsage & x509.KeyUsageCRLSign)
+
+	clientID, err := suite.manager.CreateClient(rootCaID, &generator.Options{Name: "my-client", KeyType: "ecdsa"})
+	suite.NoError(err)
+	client, err := suite.manager.GetClient(clientID)
+	suite.NoError(err)
+	cert, err := entity.ParseCertificatePEM([]byte(client.Cert))
+	suite.NoError(err)
+	suite.Equal(x509.SHA384WithRSAPSS, cert.SignatureAlgorithm)
+	suite.NoError(cert.CheckSignatureFrom(caCert))
+
+	suite.NoError(suite.manager.RevokeClient(rootCaID, clientID))
+	crlPEM, err := suite.manager.GetCRL(rootCaID)
+	suite.NoError(err)
+	block, _ := pem.Decode([]byte(crlPEM))
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	suite.NoError(err)
+	suite.Equal(x509.SHA384WithRSAPSS, crl.SignatureAlgorithm)
+	suite.NoError(crl.CheckSignatureFrom(caCert))
+
+	suite.Error(suite.manager.UpdateCAConfig(rootCaID, &types.CAConfig{SignatureAlgorithm: "ECDSA-SHA256"}))
+	suite.Error(suite.manager.UpdateCAConfig(rootCaID, &types.CAConfig{SignatureAlgorithm: "MD5-RSA"}))
+	_, err = suite.manager.CreateCA("", &generator.Options{
+		Name:     "root-ca",
+		KeyType:  "ed25519",
+		CAConfig: types.CAConfig{SignatureAlgorithm: "SHA256-RSA"},
+	})
+	suite.Error(err)
+}
+
+func (suite *ManagerSuite) TestRenewAndRekey() {
+	rootCaID, err := suite.manager.CreateCA("", &generator.Options{Name: "root-ca"})
+	suite.NoError(err)
+	serverID, err := suite.manager.CreateServer(rootCaID, &generator.Options{Name: "my-server", DNSNames: []string{"my-server.local"}})
+	suite.NoError(err)
+	original, err := suite.manager.GetServer(serverID)
+	suite.NoError(err)
+	originalCert, err := entity.ParseCertificatePEM([]byte(original.Cert))
+	suite.NoError(err)
+
+	suite.NoError(suite.manager.Renew(rootCaID, types.Server, serverID, &generator.Options{ValidFor: 48 * time.Hour}, false))
+	renewed, err := suite.manager.GetServer(serverID)
+	suite.NoError(err)
+	suite.Equal(original.Key, renewed.Key)
+	suite.Equal([]string{original.Cert}, renewed.PreviousCerts)
+	renewedCert, err := entity.ParseCertificatePEM([]byte(renewed.Cert))
+	suite.NoError(err)
+	suite.NotEqual(originalCert.SerialNumber, renewedCert.SerialNumber)
+	suite.Equal(originalCert.DNSNames, renewedCert.DNSNames)
+	suite.Equal(originalCert.ExtKeyUsage, renewedCert.ExtKeyUsage)
+	suite.Equal(48*time.Hour, renewedCert.NotAfter.Sub(renewedCert.NotBefore))
+
+	suite.NoError(suite.manager.Rekey(rootCaID, types.Server, serverID, &generator.Options{}, true))
+	rekeyed, err := suite.manager.GetServer(serverID)
+	suite.NoError(err)
+	suite.NotEqual(original.Key, rekeyed.Key)
+	suite.Equal(2, len(rekeyed.PreviousCerts))
+	rekeyedCert, err := entity.ParseCertificatePEM([]byte(rekeyed.Cert))
+	suite.NoError(err)
+	suite.Equal("my-server", rekeyedCert.Subject.CommonName)
+	suite.Equal(48*time.Hour, rekeyedCert.NotAfter.Sub(rekeyedCert.NotBefore))
+	ca, err := suite.manager.GetCA(rootCaID)
+	suite.NoError(err)
+	suite.Equal([]*big.Int{renewedCert.SerialNumber}, revokedSerials(ca))
+	suite.Equal(4, ca.Revocations[0].Reason)
+
+	subCaID, err := suite.manager.CreateCA(rootCaID, &generator.Options{Name: "sub-ca"})
+	suite.NoError(err)
+	suite.NoError(suite.manager.Renew(rootCaID, types.CA, subCaID, &generator.Options{}, false))
+	suite.Error(suite.manager.Rekey(rootCaID, types.CA, subCaID, &generator.Options{}, false))
+	suite.Error(suite.manager.Renew(subCaID, types.Server, serverID, &generator.Options{}, false))
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	suite.NoError(err)
+	csrServerID, err := suite.manager.CreateServer(rootCaID, &generator.Options{Name: "csr-server", PublicKey: pub})
+	suite.NoError(err)
+	suite.Error(suite.manager.Rekey(rootCaID, types.Server, csrServerID, &generator.Options{}, false))
+	suite.NoError(suite.manager.Renew(rootCaID, types.Server, csrServerID, &generator.Options{}, false))
+	csrServer, err := suite.manager.GetServer(csrServerID)
+	suite.NoError(err)
+	suite.Empty(csrServer.Key)
+}
+
+func (suite *ManagerSuite) TestCrossSign() {
+	oldRootID, err := suite.manager.CreateCA("", &generator.Options{Name: "old-root", Subject: types.Subject{Organization: []string{"Old Org"}}})
+	suite.NoError(err)
+	newRootID, err := suite.manager.CreateCA("", &generator.Options{Name: "new-root"})
+	suite.NoError(err)
+	serverID, err := suite.manager.CreateServer(newRootID, &generator.Options{Name: "my-server", DNSNames: []string{"my-server.local"}})
+	suite.NoError(err)
+
+	crossPEM, err := suite.manager.CrossSign(oldRootID, newRootID, &generator.Options{})
+	suite.NoError(err)
+	newRoot, err := suite.manager.GetCA(newRootID)
+	suite.NoError(err)
+	suite.Equal(crossPEM, newRoot.CrossCerts[oldRootID])
+	newRootCert, err := entity.ParseCertificatePEM([]byte(newRoot.Cert))
+	suite.NoError(err)
+	cross, err := entity.ParseCertificatePEM([]byte(crossPEM))
+	suite.NoError(err)
+	suite.Equal(newRootCert.RawSubject, cross.RawSubject)
+	suite.Equal(newRootCert.SubjectKeyId, cross.SubjectKeyId)
+
+	oldRoot, err := suite.manager.GetCA(oldRootID)
+	suite.NoError(err)
+	oldRootCert, err := entity.ParseCertificatePEM([]byte(oldRoot.Cert))
+	suite.NoError(err)
+	server, err := suite.manager.GetServer(serverID)
+	suite.NoError(err)
+	serverCert, err := entity.ParseCertificatePEM([]byte(server.Cert))
+	suite.NoError(err)
+	roots := x509.NewCertPool()
+	roots.AddCert(oldRootCert)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(cross)
+	_, err = serverCert.Verify(x509.VerifyOptions{DNSName: "my-server.local", Roots: roots, Intermediates: intermediates})
+	suite.NoError(err)
+
+	// chains offer the path to the old root
+	chain, err := suite.manager.GetChain(newRootID, types.Server, serverID, false)
+	suite.NoError(err)
+	suite.Equal([]string{"my-server", "new-root"}, commonNames(chain))
+	suite.Contains(chain, crossPEM)
+	chain, err = suite.manager.GetChain(newRootID, types.Server, serverID, true)
+	suite.NoError(err)
+	suite.Equal([]string{"my-server", "new-root", "new-root"}, commonNames(chain))
+
+	_, err = suite.manager.CrossSign(newRootID, newRootID, &generator.Options{})
+	suite.Error(err)
+
+	suite.Error(suite.manager.RevokeCrossCert(newRootID, oldRootID, nil))
+	suite.NoError(suite.manager.RevokeCrossCert(oldRootID, newRootID, &types.Revocation{Reason: reasonSuperseded}))
+	crlPEM, err := suite.manager.GetCRL(oldRootID)
+	suite.NoError(err)
+	crl, err := parseCRL(crlPEM)
+	suite.NoError(err)
+	suite.Equal(1, len(crl.RevokedCertificateEntries))
+	suite.Equal(cross.SerialNumber, crl.RevokedCertificateEntries[0].SerialNumber)
+	suite.Equal(reasonSuperseded, crl.RevokedCertificateEntries[0].ReasonCode)
+	newRoot, err = suite.manager.GetCA(newRootID)
+	suite.NoError(err)
+	suite.Empty(newRoot.CrossCerts)
+	chain, err = suite.manager.GetChain(newRootID, types.Server, serverID, false)
+	suite.NoError(err)
+	suite.Equal([]string{"my-server"}, commonNames(chain))
+	suite.Error(suite.manager.RevokeCrossCert(oldRootID, newRootID, nil))
+}
+
+func (suite *ManagerSuite) TestImportCA() {
+	root, err := generator.Generate(nil, &generator.Options{Name: "external-root", IsCA: true})
+	suite.NoError(err)
+	sub, err := generator.Generate(&types.CAEntity{Entity: root, Serial: big.NewInt(42)}, &generator.Options{Name: "external-sub", IsCA: true})
+	suite.NoError(err)
+	leaf, err := generator.Generate(nil, &generator.Options{Name: "external-leaf"})
+	suite.NoError(err)
+
+	_, err = suite.manager.ImportCA("", []byte(root.Cert), []byte(sub.Key), &types.CAConfig{})
+	suite.Error(err)
+	_, err = suite.manager.ImportCA("", []byte(leaf.Cert), []byte(leaf.Key), &types.CAConfig{})
+	suite.Error(err)
+
+	rootID, err := suite.manager.ImportCA("", []byte(root.Cert), []byte(root.Key), &types.CAConfig{})
+	suite.NoError(err)
+	otherRootID, err := suite.manager.CreateCA("", &generator.Options{Name: "other-root"})
+	suite.NoError(err)
+	_, err = suite.manager.ImportCA(otherRootID, []byte(sub.Cert), []byte(sub.Key), &types.CAConfig{})
+	suite.Error(err)
+	subID, err := suite.manager.ImportCA(rootID, []byte(sub.Cert), []byte(sub.Key), &types.CAConfig{})
+	suite.NoError(err)
+
+	rootCA, err := suite.manager.GetCA(rootID)
+	suite.NoError(err)
+	suite.Equal("external-root", rootCA.Name)
+	suite.Equal("random", rootCA.Config.SerialStrategy)
+	suite.Equal(map[string]string{subID: "external-sub"}, rootCA.CAs)
+
+	// serials issued outside of pkid are unknown, sequential serials would repeat them
+	_, err = suite.manager.ImportCA("", []byte(root.Cert), []byte(root.Key), &types.CAConfig{SerialStrategy: "sequential"})
+	suite.Error(err)
+	suite.Error(suite.manager.UpdateCAConfig(rootID, &types.CAConfig{SerialStrategy: "sequential"}))
+	suite.NoError(suite.manager.UpdateCAConfig(rootID, &types.CAConfig{}))
+	rootCA, err = suite.manager.GetCA(rootID)
+	suite.NoError(err)
+	suite.Equal("random", rootCA.Config.SerialStrategy)
+
+	clientID, err := suite.manager.CreateClient(subID, &generator.Options{Name: "my-client"})
+	suite.NoError(err)
+	client, err := suite.manager.GetClient(clientID)
+	suite.NoError(err)
+	clientCert, err := entity.ParseCertificatePEM([]byte(client.Cert))
+	suite.NoError(err)
+	subCert, err := entity.ParseCertificatePEM([]byte(sub.Cert))
+	suite.NoError(err)
+	suite.NoError(clientCert.CheckSignatureFrom(subCert))
+	suite.True(clientCert.SerialNumber.BitLen() > 64)
+
+	// the chain of a CA imported without its issuer ends with it
+	externalSubID, err := suite.manager.ImportCA("", []byte(sub.Cert), []byte(sub.Key), &types.CAConfig{})
+	suite.NoError(err)
+	clientID, err = suite.manager.CreateClient(externalSubID, &generator.Options{Name: "other-client"})
+	suite.NoError(err)
+	chain, err := suite.manager.GetChain(externalSubID, types.Client, clientID, true)
+	suite.NoError(err)
+	suite.Equal([]string{"other-client", "external-sub"}, commonNames(chain))
+}
+
+func (suite *ManagerSuite) TestImportCertificate() {
+	rootCaID, err := suite.manager.CreateCA("", &generator.Options{Name: "root-ca"})
+	suite.NoError(err)
+	otherCaID, err := suite.manager.CreateCA("", &generator.Options{Name: "other-ca"})
+	suite.NoError(err)
+	rootCa, err := suite.manager.GetCA(rootCaID)
+	suite.NoError(err)
+	external, err := generator.Generate(rootCa, &generator.Options{Name: "offline-server", Serial: big.NewInt(1000)})
+	suite.NoError(err)
+
+	_, err = suite.manager.ImportCertificate(otherCaID, types.Server, []byte(external.Cert), nil)
+	suite.Error(err)
+	_, err = suite.manager.ImportCertificate(rootCaID, types.CA, []byte(external.Cert), nil)
+	suite.Error(err)
+	serverID, err := suite.manager.ImportCertificate(rootCaID, types.Server, []byte(external.Cert), []byte(external.Key))
+	suite.NoError(err)
+	_, err = suite.manager.ImportCertificate(rootCaID, types.Client, []byte(external.Cert), nil)
+	suite.Error(err)
+
+	server, err := suite.manager.GetServer(serverID)
+	suite.NoError(err)
+	suite.Equal("offline-server", server.Name)
+	suite.NotEmpty(server.Key)
+	rootCa, err = suite.manager.GetCA(rootCaID)
+	suite.NoError(err)
+	suite.Equal(map[string]string{serverID: "offline-server"}, rootCa.Servers)
+
+	suite.NoError(suite.manager.RevokeServer(rootCaID, serverID))
+	crlPEM, err := suite.manager.GetCRL(rootCaID)
+	suite.NoError(err)
+	block, _ := pem.Decode([]byte(crlPEM))
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	suite.NoError(err)
+	suite.Equal(1, len(crl.RevokedCertificateEntries))
+	suite.Equal(int64(1000), crl.RevokedCertificateEntries[0].SerialNumber.Int64())
+}
+
+func (suite *ManagerSuite) TestPKCS12() {
+	rootCaID, err := suite.manager.CreateCA("", &generator.Options{Name: "root-ca"})
+	suite.NoError(err)
+	subCaID, err := suite.manager.CreateCA(rootCaID, &generator.Options{Name: "sub-ca"})
+	suite.NoError(err)
+	clientID, err := suite.manager.CreateClient(subCaID, &generator.Options{Name: "my-client"})
+	suite.NoError(err)
+
+	_, err = suite.manager.GetPKCS12(subCaID, types.Client, clientID, "", false)
+	suite.Error(err)
+	_, err = suite.manager.GetPKCS12(rootCaID, types.Client, clientID, "secret", false)
+	suite.Error(err)
+	for _, legacy := range []bool{false, true} {
+		data, err := suite.manager.GetPKCS12(subCaID, types.Client, clientID, "secret", legacy)
+		suite.NoError(err)
+		key, cert, caCerts, err := pkcs12.DecodeChain(data, "secret")
+		suite.NoError(err)
+		suite.NotNil(key)
+		suite.Equal("my-client", cert.Subject.CommonName)
+		suite.Equal(2, len(caCerts))
+		_, _, _, err = pkcs12.DecodeChain(data, "wrong")
+		suite.Error(err)
+	}
+}
+
+func (suite *ManagerSuite) TestChainAndBundle() {
+	rootCaID, err := suite.manager.CreateCA("", &generator.Options{Name: "root-ca"})
+	suite.NoError(err)
+	subCaID, err := suite.manager.CreateCA(rootCaID, &generator.Options{Name: "sub-ca"})
+	suite.NoError(err)
+	serverID, err := suite.manager.CreateServer(subCaID, &generator.Options{Name: "my-server"})
+	suite.NoError(err)
+
+	chain, err := suite.manager.GetChain(subCaID, types.Server, serverID, false)
+	suite.NoError(err)
+	suite.Equal([]string{"my-server", "sub-ca"}, commonNames(chain))
+	chain, err = suite.manager.GetChain(subCaID, types.Server, serverID, true)
+	suite.NoError(err)
+	suite.Equal([]string{"my-server", "sub-ca", "root-ca"}, commonNames(chain))
+	chain, err = suite.manager.GetChain(rootCaID, types.CA, subCaID, false)
+	suite.NoError(err)
+	suite.Equal([]string{"sub-ca"}, commonNames(chain))
+	_, err = suite.manager.GetChain(rootCaID, types.Server, serverID, false)
+	suite.Error(err)
+
+	otherRootID, err := suite.manager.CreateCA("", &generator.Options{Name: "other-root"})
+	suite.NoError(err)
+	_, err = suite.manager.CrossSign(otherRootID, subCaID, &generator.Options{})
+	suite.NoError(err)
+	bundle, err := suite.manager.GetBundle(subCaID)
+	suite.NoError(err)
+	suite.Equal([]string{"sub-ca", "sub-ca", "root-ca"}, commonNames(bundle))
+}
+
+func (suite *ManagerSuite) TestJWKS() {
+	caID, err := suite.manager.CreateCA("", &generator.Options{Name: "root-ca", NotBefore: time.Now().Add(-72 * time.Hour)})
+	suite.NoError(err)
+	serverID, err := suite.manager.CreateServer(caID, &generator.Options{Name: "my-server", KeyType: "rsa"})
+	suite.NoError(err)
+	clientID, err := suite.manager.CreateClient(caID, &generator.Options{Name: "my-client"})
+	suite.NoError(err)
+	revokedID, err := suite.manager.CreateClient(caID, &generator.Options{Name: "revoked-client"})
+	suite.NoError(err)
+	suite.NoError(suite.manager.RevokeClient(caID, revokedID))
+	_, err = suite.manager.CreateClient(caID, &generator.Options{Name: "expired-client", NotBefore: time.Now().Add(-48 * time.Hour), ValidFor: time.Hour})
+	suite.NoError(err)
+	_, err = suite.manager.CreateCA(caID, &generator.Options{Name: "sub-ca"})
+	suite.NoError(err)
+
+	jwk, err := suite.manager.GetJWK(caID, types.Server, serverID)
+	suite.NoError(err)
+	suite.Equal("RSA", jwk.Kty)
+	suite.Equal(1, len(jwk.X5c))
+	_, err = suite.manager.GetJWK(caID, types.Client, serverID)
+	suite.Error(err)
+
+	clientJWK, err := suite.manager.GetJWK(caID, types.Client, clientID)
+	suite.NoError(err)
+	jwks, err := suite.manager.GetJWKS(caID)
+	suite.NoError(err)
+	kids := []string{}
+	for _, key := range jwks.Keys {
+		kids = append(kids, key.Kid)
+	}
+	suite.Equal([]string{clientJWK.Kid, jwk.Kid}, kids)
+}
+
+func (suite *ManagerSuite) TestSSH() {
+	caID, err := suite.manager.CreateCA("", &generator.Options{Name: "ssh-ca"})
+	suite.NoError(err)
+	caKeyStr, err := suite.manager.GetSSHPublicKey(caID)
+	suite.NoError(err)
+	caKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(caKeyStr))
+	suite.NoError(err)
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	suite.NoError(err)
+	userKey, err := ssh.NewPublicKey(pub)
+	suite.NoError(err)
+
+	id, err := suite.manager.SignSSHKey(caID, &generator.SSHOptions{PublicKey: userKey, KeyID: "alice", Principals: []string{"alice", "admin"}, ValidFor: time.Hour})
+	suite.NoError(err)
+	sshCert, err := suite.manager.GetSSHCert(caID, id)
+	suite.NoError(err)
+	parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(sshCert.Cert))
+	suite.NoError(err)
+	cert := parsed.(*ssh.Certificate)
+	suite.Equal(uint64(1), cert.Serial)
+	suite.Equal(uint32(ssh.UserCert), cert.CertType)
+	suite.Equal([]string{"alice", "admin"}, cert.ValidPrincipals)
+	suite.Contains(cert.Extensions, "permit-pty")
+	suite.Equal(caKey.Marshal(), cert.SignatureKey.Marshal())
+	checker := &ssh.CertChecker{}
+	suite.NoError(checker.CheckCert("admin", cert))
+
+	suite.NoError(suite.manager.RevokeSSHCert(caID, id))
+	ca, err := suite.manager.GetCA(caID)
+	suite.NoError(err)
+	suite.Equal([]uint64{1}, ca.SSHRevoked)
+	krl, err := suite.manager.GetKRL(caID)
+	suite.NoError(err)
+	suite.True(bytes.Contains(krl, caKey.Marshal()))
+	_, err = suite.manager.SignSSHKey(caID, &generator.SSHOptions{PublicKey: userKey, KeyID: "bob", CertType: "host", Principals: []string{"bob.example.org"}, Extensions: map[string]string{"permit-pty": ""}})
+	suite.Error(err)
+	_, err = suite.manager.SignSSHKey(caID, &generator.SSHOptions{PublicKey: userKey, KeyID: "bob", CertType: "host"})
+	suite.Error(err)
+	_, err = suite.manager.SignSSHKey(caID, &generator.SSHOptions{PublicKey: userKey, KeyID: "bob"})
+	suite.Error(err)
+
+	otherCaID, err := suite.manager.CreateCA("", &generator.Options{Name: "other-ca"})
+	suite.NoError(err)
+	_, err = suite.manager.GetSSHCert(otherCaID, id)
+	suite.Error(err)
+}
+
+func (suite *ManagerSuite) TestRevokeCACascading() {
+	rootCaID, err := suite.manager.CreateCA("", &generator.Options{Name: "root-ca"})
+	suite.NoError(err)
+	subCaID, err := suite.manager.CreateCA(rootCaID, &generator.Options{Name: "sub-ca"})
+	suite.NoError(err)
+	subSubCaID, err := suite.manager.CreateCA(subCaID, &generator.Options{Name: "sub-sub-ca"})
+	suite.NoError(err)
+	clientID, err := suite.manager.CreateClient(subCaID, &generator.Options{Name: "my-client"})
+	suite.NoError(err)
+	serverID, err := suite.manager.CreateServer(subSubCaID, &generator.Options{Name: "my-server"})
+	suite.NoError(err)
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	suite.NoError(err)
+	userKey, err := ssh.NewPublicKey(pub)
+	suite.NoError(err)
+	sshID, err := suite.manager.SignSSHKey(subSubCaID, &generator.SSHOptions{PublicKey: userKey, KeyID: "alice", Principals: []string{"alice"}})
+	suite.NoError(err)
+	otherRootID, err := suite.manager.CreateCA("", &generator.Options{Name: "other-root"})
+	suite.NoError(err)
+	_, err = suite.manager.CrossSign(subCaID, otherRootID, &generator.Options{})
+	suite.NoError(err)
+
+	suite.Error(suite.manager.RevokeCACascading(rootCaID, subSubCaID, nil))
+	suite.NoError(suite.manager.RevokeCACascading(rootCaID, subCaID, nil))
+
+	reasons := func(caID string) []int {
+		crlPEM, err := suite.manager.GetCRL(caID)
+		suite.NoError(err)
+		block, _ := pem.Decode([]byte(crlPEM))
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		suite.NoError(err)
+		var codes []int
+		for _, entry := range crl.RevokedCertificateEntries {
+			codes = append(codes, entry.ReasonCode)
+		}
+		return codes
+	}
+	suite.Equal([]int{2}, reasons(rootCaID))
+	suite.Equal([]int{2, 2, 2}, reasons(subCaID))
+	suite.Equal([]int{2}, reasons(subSubCaID))
+	client, err := suite.manager.GetClient(clientID)
+	suite.NoError(err)
+	suite.True(client.IsRevoked)
+	server, err := suite.manager.GetServer(serverID)
+	suite.NoError(err)
+	suite.True(server.IsRevoked)
+	subSubCa, err := suite.manager.GetCA(subSubCaID)
+	suite.NoError(err)
+	suite.True(subSubCa.IsRevoked)
+	suite.Equal([]uint64{1}, subSubCa.SSHRevoked)
+	sshCert, err := suite.manager.GetSSHCert(subSubCaID, sshID)
+	suite.NoError(err)
+	suite.True(sshCert.IsRevoked)
+	otherRoot, err := suite.manager.GetCA(otherRootID)
+	suite.NoError(err)
+	suite.Empty(otherRoot.CrossCerts)
+
+	_, err = suite.manager.CreateClient(subCaID, &generator.Options{Name: "other-client"})
+	suite.Error(err)
+	_, err = suite.manager.CreateCA(subSubCaID, &generator.Options{Name: "other-ca"})
+	suite.Error(err)
+	_, err = suite.manager.SignSSHKey(subSubCaID, &generator.SSHOptions{PublicKey: userKey, KeyID: "bob", Principals: []string{"bob"}})
+	suite.Error(err)
+	_, err = suite.manager.CreateClient(rootCaID, &generator.Options{Name: "other-client"})
+	suite.NoError(err)
+}
+
+func (suite *ManagerSuite) TestRevocationRecords() {
+	caID, err := suite.manager.CreateCA("", &generator.Options{Name: "root-ca"})
+	suite.NoError(err)
+	clientID, err := suite.manager.CreateClient(caID, &generator.Options{Name: "my-client"})
+	suite.NoError(err)
+	invalidSince := time.Now().Add(-time.Hour).Truncate(time.Second)
+	suite.Error(suite.manager.Revoke(caID, types.Client, clientID, &types.Revocation{Reason: 8}))
+	suite.Error(suite.manager.Revoke(caID, types.Client, clientID, &types.Revocation{InvalidityDate: time.Now().Add(time.Hour)}))
+	suite.NoError(suite.manager.Revoke(caID, types.Client, clientID, &types.Revocation{
+		Reason:         1,
+		InvalidityDate: invalidSince,
+		Comment:        "laptop stolen",
+	}))
+	ca, err := suite.manager.GetCA(caID)
+	suite.NoError(err)
+	suite.Equal(1, len(ca.Revocations))
+	suite.Equal("laptop stolen", ca.Revocations[0].Comment)
+
+	crlPEM, err := suite.manager.GetCRL(caID)
+	suite.NoError(err)
+	block, _ := pem.Decode([]byte(crlPEM))
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	suite.NoError(err)
+	entry := crl.RevokedCertificateEntries[0]
+	suite.Equal(1, entry.ReasonCode)
+	suite.True(entry.RevocationTime.Equal(ca.Revocations[0].Time.Truncate(time.Second)))
+	var invalidityDate time.Time
+	for _, ext := range entry.Extensions {
+		if ext.Id.String() == "2.5.29.24" {
+			_, err = asn1.UnmarshalWithParams(ext.Value, &invalidityDate, "generalized")
+			suite.NoError(err)
+		}
+	}
+	suite.True(invalidSince.Equal(invalidityDate))
+
+	// revocation times have to stay stable between CRL's
+	time.Sleep(1100 * time.Millisecond)
+	crlPEM, err = suite.manager.GetCRL(caID)
+	suite.NoError(err)
+	block, _ = pem.Decode([]byte(crlPEM))
+	crl, err = x509.ParseRevocationList(block.Bytes)
+	suite.NoError(err)
+	suite.True(entry.RevocationTime.Equal(crl.RevokedCertificateEntries[0].RevocationTime))
+
+	reason, err := ParseRevocationReason("cessationofoperation")
+	suite.NoError(err)
+	suite.Equal(5, reason)
+	_, err = ParseRevocationReason("removeFromCRL")
+	suite.Error(err)
+}
+
+func (suite *ManagerSuite) TestDeltaCRL() {
+	_, err := suite.manager.CreateCA("", &generator.Options{Name: "root-ca", CAConfig: types.CAConfig{CRLInterval: "48h", CRLValidity: "24h"}})
+	suite.Error(err)
+	config := types.CAConfig{CRLInterval: "1h", CRLValidity: "48h", DeltaCRLValidity: "10m"}
+	caID, err := suite.manager.CreateCA("", &generator.Options{Name: "root-ca", CAConfig: config})
+	suite.NoError(err)
+	client1, err := suite.manager.CreateClient(caID, &generator.Options{Name: "client-1"})
+	suite.NoError(err)
+	client2, err := suite.manager.CreateClient(caID, &generator.Options{Name: "client-2"})
+	suite.NoError(err)
+	parse := func(data string, err error) *x509.RevocationList {
+		suite.NoError(err)
+		block, _ := pem.Decode([]byte(data))
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		suite.NoError(err)
+		return crl
+	}
+	deltaBase := func(crl *x509.RevocationList) *big.Int {
+		for _, ext := range crl.Extensions {
+			if ext.Id.String() == "2.5.29.27" {
+				suite.True(ext.Critical)
+				number := new(big.Int)
+				_, err := asn1.Unmarshal(ext.Value, &number)
+				suite.NoError(err)
+				return number
+			}
+		}
+		return nil
+	}
+
+	base := parse(suite.manager.GetCRL(caID))
+	suite.Equal(big.NewInt(1), base.Number)
+	suite.Equal(48*time.Hour, base.NextUpdate.Sub(base.ThisUpdate))
+	suite.Equal(0, len(base.RevokedCertificateEntries))
+	suite.Equal(base.Raw, parse(suite.manager.GetCRL(caID)).Raw)
+
+	suite.NoError(suite.manager.RevokeClient(caID, client1))
+	suite.Equal(base.Raw, parse(suite.manager.GetCRL(caID)).Raw)
+	delta := parse(suite.manager.GetDeltaCRL(caID))
+	suite.Equal(1, len(delta.RevokedCertificateEntries))
+	suite.Equal(10*time.Minute, delta.NextUpdate.Sub(delta.ThisUpdate))
+	suite.Equal(new(big.Int).Add(base.Number, big.NewInt(1)), delta.Number)
+	suite.Equal(base.Number, deltaBase(delta))
+	suite.Equal(delta.Raw, parse(suite.manager.GetDeltaCRL(caID)).Raw)
+
+	suite.NoError(suite.manager.RevokeClient(caID, client2))
+	delta = parse(suite.manager.GetDeltaCRL(caID))
+	suite.Equal(2, len(delta.RevokedCertificateEntries))
+	suite.Equal(new(big.Int).Add(base.Number, big.NewInt(2)), delta.Number)
+
+	// without interval every revocation leads to a new base CRL
+	config.CRLInterval = ""
+	suite.NoError(suite.manager.UpdateCAConfig(caID, &config))
+	newBase := parse(suite.manager.GetCRL(caID))
+	suite.Equal(2, len(newBase.RevokedCertificateEntries))
+	suite.Equal(new(big.Int).Add(base.Number, big.NewInt(3)), newBase.Number)
+	delta = parse(suite.manager.GetDeltaCRL(caID))
+	suite.Equal(0, len(delta.RevokedCertificateEntries))
+	suite.Equal(newBase.Number, deltaBase(delta))
+	client3, err := suite.manager.CreateClient(caID, &generator.Options{Name: "client-3"})
+	suite.NoError(err)
+	suite.NoError(suite.manager.RevokeClient(caID, client3))
+	suite.Equal(3, len(parse(suite.manager.GetCRL(caID)).RevokedCertificateEntries))
+}
+
+func revokedSerials(ca *types.CAEntity) []*big.Int {
+	serials := []*big.Int{}
+	for _, revocation := range ca.Revocations {
+		serials = append(serials, revocation.Serial)
+	}
+	return serials
+}
+
+func commonNames(data string) []string {
+	var names []string
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return names
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil
+		}
+		names = append(names, cert.Subject.CommonName)
+	}
+}
+
 func TestBasicManager(t *testing.T) {
 	store, _ := storage.NewFSStorage("./test-store")
 	mgr := NewBasicManager(store)
@@ -117,3 +925,162 @@ func TestThreadSafeManager(t *testing.T) {
 	mgr := NewThreadSafeManager(store)
 	suite.Run(t, NewManagerSuite(mgr))
 }
+
+func TestSerialIndexMigration(t *testing.T) {
+	defer os.RemoveAll("./test-store-migration")
+	store, _ := storage.NewFSStorage("./test-store-migration")
+	mgr := NewBasicManager(store)
+	rootCaID, err := mgr.CreateCA("", &generator.Options{Name: "root-ca"})
+	assert.NoError(t, err)
+	_, err = mgr.CreateClient(rootCaID, &generator.Options{Name: "client-1"})
+	assert.NoError(t, err)
+	_, err = mgr.CreateServer(rootCaID, &generator.Options{Name: "server-1"})
+	assert.NoError(t, err)
+
+	// simulate a CA of an older version with a counter which fell behind
+	ca, err := store.LoadCA(rootCaID)
+	assert.NoError(t, err)
+	ca.Serial = big.NewInt(1)
+	ca.SerialsIndexed = false
+	assert.NoError(t, store.SaveCA(ca))
+
+	clientID, err := mgr.CreateClient(rootCaID, &generator.Options{Name: "client-2"})
+	assert.NoError(t, err)
+	client, err := mgr.GetClient(clientID)
+	assert.NoError(t, err)
+	cert, err := entity.ParseCertificatePEM([]byte(client.Cert))
+	assert.NoError(t, err)
+	assert.Equal(t, big.NewInt(3), cert.SerialNumber)
+	id, err := store.LoadSerial(rootCaID, big.NewInt(3))
+	assert.NoError(t, err)
+	assert.Equal(t, clientID, id)
+	ca, err = store.LoadCA(rootCaID)
+	assert.NoError(t, err)
+	assert.True(t, ca.SerialsIndexed)
+}
+
+func TestLegacyParent(t *testing.T) {
+	defer os.RemoveAll("./test-store-legacy-parent")
+	store, _ := storage.NewFSStorage("./test-store-legacy-parent")
+	mgr := NewBasicManager(store)
+	rootCaID, err := mgr.CreateCA("", &generator.Options{Name: "root-ca"})
+	assert.NoError(t, err)
+	subCaID, err := mgr.CreateCA(rootCaID, &generator.Options{Name: "sub-ca"})
+	assert.NoError(t, err)
+	serverID, err := mgr.CreateServer(subCaID, &generator.Options{Name: "my-server"})
+	assert.NoError(t, err)
+
+	// simulate a sub CA of an older version which does not know its parent
+	subCa, err := store.LoadCA(subCaID)
+	assert.NoError(t, err)
+	subCa.Parent = ""
+	assert.NoError(t, store.SaveCA(subCa))
+
+	chain, err := mgr.GetChain(subCaID, types.Server, serverID, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"my-server", "sub-ca", "root-ca"}, commonNames(chain))
+	subCa, err = store.LoadCA(subCaID)
+	assert.NoError(t, err)
+	assert.Equal(t, rootCaID, subCa.Parent)
+
+	// a sub CA whose issuer can not be found has no complete chain
+	subCa.Parent = ""
+	assert.NoError(t, store.SaveCA(subCa))
+	rootCa, err := store.LoadCA(rootCaID)
+	assert.NoError(t, err)
+	delete(rootCa.CAs, subCaID)
+	assert.NoError(t, store.SaveCA(rootCa))
+	_, err = mgr.GetChain(subCaID, types.Server, serverID, true)
+	assert.Error(t, err)
+	_, err = mgr.GetBundle(subCaID)
+	assert.Error(t, err)
+}
+
+func TestRevocationMigration(t *testing.T) {
+	defer os.RemoveAll("./test-store-revocations")
+	store, _ := storage.NewFSStorage("./test-store-revocations")
+	mgr := NewBasicManager(store)
+	caID, err := mgr.CreateCA("", &generator.Options{Name: "root-ca"})
+	assert.NoError(t, err)
+
+	// simulate a CA of an older version with a plain list of revoked serials and no stored CRL number
+	ca, err := store.LoadCA(caID)
+	assert.NoError(t, err)
+	ca.Revoked = []*big.Int{big.NewInt(7), big.NewInt(9), big.NewInt(7)}
+	ca.CRLs.Number = nil
+	assert.NoError(t, store.SaveCA(ca))
+
+	_, err = mgr.GetCRL(caID)
+	assert.NoError(t, err)
+	ca, err = store.LoadCA(caID)
+	assert.NoError(t, err)
+	assert.Empty(t, ca.Revoked)
+	assert.Equal(t, 2, len(ca.Revocations))
+	assert.Equal(t, big.NewInt(7), ca.Revocations[0].Serial)
+	assert.Equal(t, 0, ca.Revocations[0].Reason)
+	assert.False(t, ca.Revocations[0].Time.IsZero())
+	assert.Equal(t, big.NewInt(1), ca.CRLs.Number)
+}
+
+func TestCRLWithoutSubjectKeyId(t *testing.T) {
+	defer os.RemoveAll("./test-store-legacy-crl")
+	store, _ := storage.NewFSStorage("./test-store-legacy-crl")
+	mgr := NewBasicManager(store)
+	// created by openssl without subject key identifier and cRLSign key usage
+	certPEM, err := ioutil.ReadFile("test-legacy-ca.crt")
+	assert.NoError(t, err)
+	keyPEM, err := ioutil.ReadFile("test-legacy-ca.key")
+	assert.NoError(t, err)
+	caID, err := mgr.ImportCA("", certPEM, keyPEM, &types.CAConfig{})
+	assert.NoError(t, err)
+	ca, _ := mgr.GetCA(caID)
+	caCert, err := entity.ParseCertificatePEM([]byte(ca.Cert))
+	assert.NoError(t, err)
+	assert.Empty(t, caCert.SubjectKeyId)
+
+	crlPEM, err := mgr.GetCRL(caID)
+	assert.NoError(t, err)
+	crl, err := parseCRL(crlPEM)
+	assert.NoError(t, err)
+	assert.NoError(t, caCert.CheckSignature(crl.SignatureAlgorithm, crl.RawTBSRevocationList, crl.Signature))
+	expected, err := generator.KeyIdentifier(caCert.PublicKey)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, crl.AuthorityKeyId)
+}
+
+func TestIssuerURLs(t *testing.T) {
+	defer os.RemoveAll("./test-store-urls")
+	store, _ := storage.NewFSStorage("./test-store-urls")
+	mgr := NewBasicManager(store, "https://pki.example.org/")
+	rootCaID, err := mgr.CreateCA("", &generator.Options{Name: "root-ca"})
+	assert.NoError(t, err)
+	caID, err := mgr.CreateCA(rootCaID, &generator.Options{
+		Name:     "my-ca",
+		CAConfig: types.CAConfig{OCSPURL: "http://ocsp.example.org"},
+	})
+	assert.NoError(t, err)
+	clientID, err := mgr.CreateClient(caID, &generator.Options{Name: "my-client"})
+	assert.NoError(t, err)
+
+	root, _ := mgr.GetCA(rootCaID)
+	rootCert, err := entity.ParseCertificatePEM([]byte(root.Cert))
+	assert.NoError(t, err)
+	ca, _ := mgr.GetCA(caID)
+	caCert, err := entity.ParseCertificatePEM([]byte(ca.Cert))
+	assert.NoError(t, err)
+	client, _ := mgr.GetClient(clientID)
+	clientCert, err := entity.ParseCertificatePEM([]byte(client.Cert))
+	assert.NoError(t, err)
+
+	assert.Empty(t, rootCert.CRLDistributionPoints)
+	assert.Equal(t, []string{"https://pki.example.org/ca/" + rootCaID + "/crl?format=der"}, caCert.CRLDistributionPoints)
+	assert.Equal(t, []string{"https://pki.example.org/ca/" + rootCaID + "/cert?format=der"}, caCert.IssuingCertificateURL)
+	assert.Equal(t, []string{"https://pki.example.org/ca/" + caID + "/crl?format=der"}, clientCert.CRLDistributionPoints)
+	assert.Equal(t, []string{"http://ocsp.example.org"}, clientCert.OCSPServer)
+	assert.NotEmpty(t, clientCert.SubjectKeyId)
+	assert.Equal(t, rootCert.SubjectKeyId, caCert.AuthorityKeyId)
+	assert.Equal(t, caCert.SubjectKeyId, clientCert.AuthorityKeyId)
+
+	err = mgr.UpdateCAConfig(caID, &types.CAConfig{CRLURL: "not a url"})
+	assert.Error(t, err)
+}
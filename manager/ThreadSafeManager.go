@@ -1,6 +1,7 @@
 package manager
 
 import (
+	"github.com/trusch/pkid/entity"
 	"github.com/trusch/pkid/generator"
 	"github.com/trusch/pkid/storage"
 	"github.com/trusch/pkid/types"
@@ -12,9 +13,10 @@ type ThreadSafeManager struct {
 	transaction *transaction.Manager
 }
 
-func NewThreadSafeManager(store storage.Storage) Manager {
+// NewThreadSafeManager returns a manager which serializes all operations, see NewBasicManager for the base URL
+func NewThreadSafeManager(store storage.Storage, baseURL ...string) Manager {
 	mgr := &ThreadSafeManager{
-		basic:       &BasicManager{store},
+		basic:       newBasicManager(store, baseURL...),
 		transaction: transaction.NewManager(nil),
 	}
 	return mgr
@@ -41,6 +43,13 @@ func (mgr *ThreadSafeManager) GetServer(id string) (*types.Entity, error) {
 	return v.(*types.Entity), e
 }
 
+func (mgr *ThreadSafeManager) UpdateCAConfig(caID string, config *types.CAConfig) error {
+	_, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return nil, mgr.basic.UpdateCAConfig(caID, config)
+	})
+	return e
+}
+
 func (mgr *ThreadSafeManager) CreateCA(caID string, options *generator.Options) (string, error) {
 	v, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
 		return mgr.basic.CreateCA(caID, options)
@@ -69,6 +78,20 @@ func (mgr *ThreadSafeManager) RevokeCA(caID, id string) error {
 	return e
 }
 
+func (mgr *ThreadSafeManager) RevokeCACascading(caID, id string, revocation *types.Revocation) error {
+	_, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return nil, mgr.basic.RevokeCACascading(caID, id, revocation)
+	})
+	return e
+}
+
+func (mgr *ThreadSafeManager) Revoke(caID string, typ types.EntityType, id string, revocation *types.Revocation) error {
+	_, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return nil, mgr.basic.Revoke(caID, typ, id, revocation)
+	})
+	return e
+}
+
 func (mgr *ThreadSafeManager) RevokeClient(caID, id string) error {
 	_, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
 		return nil, mgr.basic.RevokeClient(caID, id)
@@ -89,3 +112,171 @@ func (mgr *ThreadSafeManager) GetCRL(caID string) (string, error) {
 	})
 	return v.(string), e
 }
+
+func (mgr *ThreadSafeManager) GetDeltaCRL(caID string) (string, error) {
+	v, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return mgr.basic.GetDeltaCRL(caID)
+	})
+	return v.(string), e
+}
+
+func (mgr *ThreadSafeManager) GetIssued(id string) (*types.Entity, error) {
+	v, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return mgr.basic.GetIssued(id)
+	})
+	return v.(*types.Entity), e
+}
+
+func (mgr *ThreadSafeManager) Issue(caID, profile string, options *generator.Options) (string, error) {
+	v, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return mgr.basic.Issue(caID, profile, options)
+	})
+	return v.(string), e
+}
+
+func (mgr *ThreadSafeManager) RevokeIssued(caID, id string) error {
+	_, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return nil, mgr.basic.RevokeIssued(caID, id)
+	})
+	return e
+}
+
+func (mgr *ThreadSafeManager) GetProfile(name string) (*types.Profile, error) {
+	v, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return mgr.basic.GetProfile(name)
+	})
+	return v.(*types.Profile), e
+}
+
+func (mgr *ThreadSafeManager) ListProfiles() ([]string, error) {
+	v, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return mgr.basic.ListProfiles()
+	})
+	return v.([]string), e
+}
+
+func (mgr *ThreadSafeManager) SaveProfile(profile *types.Profile) error {
+	_, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return nil, mgr.basic.SaveProfile(profile)
+	})
+	return e
+}
+
+func (mgr *ThreadSafeManager) DeleteProfile(name string) error {
+	_, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return nil, mgr.basic.DeleteProfile(name)
+	})
+	return e
+}
+
+func (mgr *ThreadSafeManager) Renew(caID string, typ types.EntityType, id string, options *generator.Options, revokeOld bool) error {
+	_, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return nil, mgr.basic.Renew(caID, typ, id, options, revokeOld)
+	})
+	return e
+}
+
+func (mgr *ThreadSafeManager) Rekey(caID string, typ types.EntityType, id string, options *generator.Options, revokeOld bool) error {
+	_, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return nil, mgr.basic.Rekey(caID, typ, id, options, revokeOld)
+	})
+	return e
+}
+
+func (mgr *ThreadSafeManager) CrossSign(caID, otherCaID string, options *generator.Options) (string, error) {
+	v, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return mgr.basic.CrossSign(caID, otherCaID, options)
+	})
+	return v.(string), e
+}
+
+func (mgr *ThreadSafeManager) RevokeCrossCert(caID, otherCaID string, revocation *types.Revocation) error {
+	_, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return nil, mgr.basic.RevokeCrossCert(caID, otherCaID, revocation)
+	})
+	return e
+}
+
+func (mgr *ThreadSafeManager) ImportCA(parentID string, certPEM, keyPEM []byte, config *types.CAConfig) (string, error) {
+	v, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return mgr.basic.ImportCA(parentID, certPEM, keyPEM, config)
+	})
+	return v.(string), e
+}
+
+func (mgr *ThreadSafeManager) ImportCertificate(caID string, typ types.EntityType, certPEM, keyPEM []byte) (string, error) {
+	v, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return mgr.basic.ImportCertificate(caID, typ, certPEM, keyPEM)
+	})
+	return v.(string), e
+}
+
+func (mgr *ThreadSafeManager) GetPKCS12(caID string, typ types.EntityType, id, password string, legacy bool) ([]byte, error) {
+	v, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return mgr.basic.GetPKCS12(caID, typ, id, password, legacy)
+	})
+	return v.([]byte), e
+}
+
+func (mgr *ThreadSafeManager) GetChain(caID string, typ types.EntityType, id string, includeRoot bool) (string, error) {
+	v, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return mgr.basic.GetChain(caID, typ, id, includeRoot)
+	})
+	return v.(string), e
+}
+
+func (mgr *ThreadSafeManager) GetBundle(caID string) (string, error) {
+	v, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return mgr.basic.GetBundle(caID)
+	})
+	return v.(string), e
+}
+
+func (mgr *ThreadSafeManager) GetJWK(caID string, typ types.EntityType, id string) (*entity.JWK, error) {
+	v, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return mgr.basic.GetJWK(caID, typ, id)
+	})
+	return v.(*entity.JWK), e
+}
+
+func (mgr *ThreadSafeManager) GetJWKS(caID string) (*entity.JWKSet, error) {
+	v, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return mgr.basic.GetJWKS(caID)
+	})
+	return v.(*entity.JWKSet), e
+}
+
+func (mgr *ThreadSafeManager) GetSSHPublicKey(caID string) (string, error) {
+	v, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return mgr.basic.GetSSHPublicKey(caID)
+	})
+	return v.(string), e
+}
+
+func (mgr *ThreadSafeManager) SignSSHKey(caID string, options *generator.SSHOptions) (string, error) {
+	v, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return mgr.basic.SignSSHKey(caID, options)
+	})
+	return v.(string), e
+}
+
+func (mgr *ThreadSafeManager) GetSSHCert(caID, id string) (*types.SSHCert, error) {
+	v, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return mgr.basic.GetSSHCert(caID, id)
+	})
+	return v.(*types.SSHCert), e
+}
+
+func (mgr *ThreadSafeManager) RevokeSSHCert(caID, id string) error {
+	_, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return nil, mgr.basic.RevokeSSHCert(caID, id)
+	})
+	return e
+}
+
+func (mgr *ThreadSafeManager) GetKRL(caID string) ([]byte, error) {
+	v, e := mgr.transaction.Transaction(func(context interface{}) (interface{}, error) {
+		return mgr.basic.GetKRL(caID)
+	})
+	return v.([]byte), e
+}
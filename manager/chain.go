@@ -0,0 +1,169 @@
+package manager
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"sort"
+
+	"github.com/trusch/pkid/entity"
+	"github.com/trusch/pkid/types"
+)
+
+// GetChain returns the pem encoded certificate of an entity followed by the certificates of its issuers,
+// each followed by its cross-signed certificates. The self signed root is only included if includeRoot is set.
+func (mgr *BasicManager) GetChain(caID string, typ types.EntityType, id string, includeRoot bool) (string, error) {
+	ca, err := mgr.GetCA(caID)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := children(ca, typ)[id]; !ok {
+		return "", fmt.Errorf("%v is not issued by %v", id, caID)
+	}
+	e, err := mgr.loadEntity(typ, id)
+	if err != nil {
+		return "", err
+	}
+	cas, err := mgr.issuers(ca)
+	if err != nil {
+		return "", err
+	}
+	out := bytes.NewBufferString(e.Cert)
+	for _, ca := range cas {
+		cert, err := entity.ParseCertificatePEM([]byte(ca.Cert))
+		if err != nil {
+			return "", err
+		}
+		if includeRoot || !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			out.WriteString(ca.Cert)
+		}
+		for _, cross := range crossCerts(ca) {
+			out.WriteString(cross)
+		}
+	}
+	return out.String(), nil
+}
+
+// GetBundle returns the pem encoded certificates of a CA and its issuers up to the root,
+// each followed by its cross-signed certificates
+func (mgr *BasicManager) GetBundle(caID string) (string, error) {
+	ca, err := mgr.GetCA(caID)
+	if err != nil {
+		return "", err
+	}
+	cas, err := mgr.issuers(ca)
+	if err != nil {
+		return "", err
+	}
+	out := &bytes.Buffer{}
+	for _, ca := range cas {
+		out.WriteString(ca.Cert)
+		for _, cross := range crossCerts(ca) {
+			out.WriteString(cross)
+		}
+	}
+	return out.String(), nil
+}
+
+// crossCerts returns the pem encoded cross-signed certificates of ca ordered by the ID of their issuer
+func crossCerts(ca *types.CAEntity) []string {
+	signers := make([]string, 0, len(ca.CrossCerts))
+	for signer := range ca.CrossCerts {
+		signers = append(signers, signer)
+	}
+	sort.Strings(signers)
+	certs := make([]string, len(signers))
+	for idx, signer := range signers {
+		certs[idx] = ca.CrossCerts[signer]
+	}
+	return certs
+}
+
+// issuers returns ca and its parents up to the root
+func (mgr *BasicManager) issuers(ca *types.CAEntity) ([]*types.CAEntity, error) {
+	var cas []*types.CAEntity
+	seen := map[string]bool{}
+	for ca != nil && !seen[ca.ID] {
+		seen[ca.ID] = true
+		cas = append(cas, ca)
+		parent, err := mgr.parent(ca)
+		if err != nil {
+			return nil, err
+		}
+		ca = parent
+	}
+	return cas, nil
+}
+
+// parent returns the issuer of ca, nil for root CA's and CA's imported without their issuer.
+// Sub CA's of older versions don't know their parent, it is looked up and remembered.
+func (mgr *BasicManager) parent(ca *types.CAEntity) (*types.CAEntity, error) {
+	if ca.Parent != "" {
+		return mgr.GetCA(ca.Parent)
+	}
+	if ca.Imported {
+		// CA's imported without their issuer end their chain
+		return nil, nil
+	}
+	cert, err := entity.ParseCertificatePEM([]byte(ca.Cert))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		return nil, nil
+	}
+	parent, err := mgr.findParent(ca.ID)
+	if err != nil {
+		return nil, err
+	}
+	if parent == nil {
+		// CA's of older versions are only indexed after they have been loaded once
+		return nil, fmt.Errorf("issuer of CA %v not found, request the issuing CA once to index it", ca.ID)
+	}
+	ca.Parent = parent.ID
+	return parent, mgr.store.SaveCA(ca)
+}
+
+// findParent returns the indexed CA which lists the CA with the given ID as sub CA, nil if there is none
+func (mgr *BasicManager) findParent(id string) (*types.CAEntity, error) {
+	ids, err := mgr.store.ListCAs()
+	if err != nil {
+		return nil, err
+	}
+	for _, caID := range ids {
+		ca, err := mgr.store.LoadCA(caID)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := ca.CAs[id]; ok {
+			return ca, nil
+		}
+	}
+	return nil, nil
+}
+
+// issuerChain returns the certificates of ca and its parents up to the root
+func (mgr *BasicManager) issuerChain(ca *types.CAEntity) ([]*x509.Certificate, error) {
+	cas, err := mgr.issuers(ca)
+	if err != nil {
+		return nil, err
+	}
+	chain := make([]*x509.Certificate, len(cas))
+	for idx, ca := range cas {
+		if chain[idx], err = entity.ParseCertificatePEM([]byte(ca.Cert)); err != nil {
+			return nil, err
+		}
+	}
+	return chain, nil
+}
+
+// withoutRoot removes the last certificate of a chain if it is self signed
+func withoutRoot(chain []*x509.Certificate) []*x509.Certificate {
+	if len(chain) == 0 {
+		return chain
+	}
+	if last := chain[len(chain)-1]; bytes.Equal(last.RawIssuer, last.RawSubject) {
+		return chain[:len(chain)-1]
+	}
+	return chain
+}
@@ -0,0 +1,219 @@
+package manager
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/trusch/pkid/entity"
+	"github.com/trusch/pkid/generator"
+	"github.com/trusch/pkid/types"
+)
+
+const (
+	defaultCRLValidity      = 365 * 24 * time.Hour
+	defaultDeltaCRLValidity = time.Hour
+)
+
+var oidDeltaCRLIndicator = asn1.ObjectIdentifier{2, 5, 29, 27}
+
+// GetCRL returns the base CRL of a CA, it is only re-signed when it is due
+func (mgr *BasicManager) GetCRL(caID string) (string, error) {
+	ca, err := mgr.GetCA(caID)
+	if err != nil {
+		return "", err
+	}
+	changed := migrateRevocations(ca)
+	refreshed, err := mgr.refreshBaseCRL(ca)
+	if err != nil {
+		return "", err
+	}
+	if changed || refreshed {
+		if err = mgr.store.SaveCA(ca); err != nil {
+			return "", err
+		}
+	}
+	return ca.CRLs.Base, nil
+}
+
+// GetDeltaCRL returns a delta CRL with the revocations since the base CRL of a CA
+func (mgr *BasicManager) GetDeltaCRL(caID string) (string, error) {
+	ca, err := mgr.GetCA(caID)
+	if err != nil {
+		return "", err
+	}
+	changed := migrateRevocations(ca)
+	refreshed, err := mgr.refreshBaseCRL(ca)
+	if err != nil {
+		return "", err
+	}
+	deltaRefreshed, err := mgr.refreshDeltaCRL(ca)
+	if err != nil {
+		return "", err
+	}
+	if changed || refreshed || deltaRefreshed {
+		if err = mgr.store.SaveCA(ca); err != nil {
+			return "", err
+		}
+	}
+	return ca.CRLs.Delta, nil
+}
+
+// refreshBaseCRL signs a new base CRL if the cached one is due and reports whether the CA has to be saved.
+// With a CRL interval the base CRL is renewed after the interval, without it after every
+// revocation and halfway through its validity.
+func (mgr *BasicManager) refreshBaseCRL(ca *types.CAEntity) (bool, error) {
+	validity, interval, _, err := crlTimes(&ca.Config)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	if ca.CRLs.Base != "" {
+		base, err := parseCRL(ca.CRLs.Base)
+		if err != nil {
+			return false, err
+		}
+		renewAt := base.ThisUpdate.Add(interval)
+		if interval == 0 {
+			renewAt = base.ThisUpdate.Add(validity / 2)
+		}
+		upToDate := interval != 0 || len(ca.Revocations) == ca.CRLs.BaseRevocations
+		if upToDate && now.Before(renewAt) {
+			return false, nil
+		}
+	}
+	crl, err := mgr.signCRL(ca, ca.Revocations, now, validity, nil)
+	if err != nil {
+		return false, err
+	}
+	ca.CRLs.Base, ca.CRLs.BaseRevocations = crl, len(ca.Revocations)
+	ca.CRLs.Delta, ca.CRLs.DeltaRevocations = "", 0
+	return true, nil
+}
+
+// refreshDeltaCRL signs a new delta CRL after every revocation and halfway through the validity of the
+// cached one and reports whether the CA has to be saved. The base CRL has to be up to date.
+func (mgr *BasicManager) refreshDeltaCRL(ca *types.CAEntity) (bool, error) {
+	_, _, validity, err := crlTimes(&ca.Config)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	if ca.CRLs.Delta != "" {
+		delta, err := parseCRL(ca.CRLs.Delta)
+		if err != nil {
+			return false, err
+		}
+		if len(ca.Revocations) == ca.CRLs.DeltaRevocations && now.Before(delta.ThisUpdate.Add(validity/2)) {
+			return false, nil
+		}
+	}
+	base, err := parseCRL(ca.CRLs.Base)
+	if err != nil {
+		return false, err
+	}
+	baseNumber, err := asn1.Marshal(base.Number)
+	if err != nil {
+		return false, err
+	}
+	indicator := pkix.Extension{Id: oidDeltaCRLIndicator, Critical: true, Value: baseNumber}
+	crl, err := mgr.signCRL(ca, ca.Revocations[ca.CRLs.BaseRevocations:], now, validity, []pkix.Extension{indicator})
+	if err != nil {
+		return false, err
+	}
+	ca.CRLs.Delta, ca.CRLs.DeltaRevocations = crl, len(ca.Revocations)
+	return true, nil
+}
+
+// signCRL returns a pem encoded CRL with the next CRL number of the CA, the caller has to save the CA
+func (mgr *BasicManager) signCRL(ca *types.CAEntity, revocations []*types.Revocation, now time.Time, validity time.Duration, extensions []pkix.Extension) (string, error) {
+	algo, err := generator.ParseSignatureAlgorithm(ca.Config.SignatureAlgorithm)
+	if err != nil {
+		return "", err
+	}
+	revokedCerts := make([]x509.RevocationListEntry, len(revocations))
+	for idx, revocation := range revocations {
+		revokedCerts[idx], err = revocationListEntry(revocation)
+		if err != nil {
+			return "", err
+		}
+	}
+	caEntity, err := entity.NewEntityFromPEM([]byte(ca.Cert), []byte(ca.Key))
+	if err != nil {
+		return "", err
+	}
+	signer, ok := caEntity.Key.(crypto.Signer)
+	if !ok {
+		return "", errors.New("CA key can not sign")
+	}
+	// CA's created by older versions lack the cRLSign key usage and the subject key identifier,
+	// x509 refuses to sign CRL's for them without them
+	issuer := *caEntity.Cert
+	issuer.KeyUsage |= x509.KeyUsageCRLSign
+	if len(issuer.SubjectKeyId) == 0 {
+		issuer.SubjectKeyId, err = generator.KeyIdentifier(issuer.PublicKey)
+		if err != nil {
+			return "", err
+		}
+	}
+	number := big.NewInt(1)
+	if ca.CRLs.Number != nil {
+		number.Add(number, ca.CRLs.Number)
+	}
+	template := &x509.RevocationList{
+		SignatureAlgorithm:        algo,
+		RevokedCertificateEntries: revokedCerts,
+		Number:                    number,
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(validity),
+		ExtraExtensions:           extensions,
+	}
+	derCRL, err := x509.CreateRevocationList(rand.Reader, template, &issuer, signer)
+	if err != nil {
+		return "", err
+	}
+	ca.CRLs.Number = number
+	out := &bytes.Buffer{}
+	err = pem.Encode(out, &pem.Block{Type: "X509 CRL", Bytes: derCRL})
+	if err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func parseCRL(data string) (*x509.RevocationList, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("failed to decode cached CRL")
+	}
+	return x509.ParseRevocationList(block.Bytes)
+}
+
+// crlTimes returns the validity of base CRL's, the interval in which they are renewed
+// (0 for renewal on revocation) and the validity of delta CRL's
+func crlTimes(config *types.CAConfig) (time.Duration, time.Duration, time.Duration, error) {
+	validity, deltaValidity := defaultCRLValidity, defaultDeltaCRLValidity
+	var err error
+	if config.CRLValidity != "" {
+		if validity, err = parseDuration(config.CRLValidity); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	interval, err := parseDuration(config.CRLInterval)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if config.DeltaCRLValidity != "" {
+		if deltaValidity, err = parseDuration(config.DeltaCRLValidity); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	return validity, interval, deltaValidity, nil
+}
@@ -0,0 +1,99 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/trusch/pkid/entity"
+	"github.com/trusch/pkid/generator"
+	"github.com/trusch/pkid/types"
+)
+
+// CrossSign issues a certificate for the key and subject of the CA otherCaID signed by the CA caID.
+// The certificate is stored in the CrossCerts of the other CA and returned pem encoded,
+// the CA caID lists the other CA in CrossSigned. From options only the validity is used.
+func (mgr *BasicManager) CrossSign(caID, otherCaID string, options *generator.Options) (string, error) {
+	if caID == otherCaID {
+		return "", errors.New("a CA can not cross-sign itself")
+	}
+	ca, err := mgr.GetCA(caID)
+	if err != nil {
+		return "", err
+	}
+	other, err := mgr.GetCA(otherCaID)
+	if err != nil {
+		return "", err
+	}
+	if ca.IsRevoked || other.IsRevoked {
+		return "", errors.New("can not cross-sign with or for a revoked CA")
+	}
+	otherCert, err := entity.ParseCertificatePEM([]byte(other.Cert))
+	if err != nil {
+		return "", err
+	}
+	crossOptions := generator.OptionsFromCertificate(otherCert)
+	crossOptions.PublicKey = otherCert.PublicKey
+	crossOptions.NotBefore = options.NotBefore
+	crossOptions.ValidFor = options.ValidFor
+	cross, err := mgr.sign(ca, crossOptions)
+	if err != nil {
+		return "", err
+	}
+	if other.CrossCerts == nil {
+		other.CrossCerts = make(map[string]string)
+	}
+	other.CrossCerts[ca.ID] = cross.Cert
+	if err = mgr.store.SaveCA(other); err != nil {
+		return "", err
+	}
+	if ca.CrossSigned == nil {
+		ca.CrossSigned = make(map[string]string)
+	}
+	ca.CrossSigned[other.ID] = other.Name
+	cross.ID = other.ID
+	if err = mgr.register(ca, cross); err != nil {
+		return "", err
+	}
+	return cross.Cert, nil
+}
+
+// RevokeCrossCert revokes the certificate the CA caID has issued for the CA otherCaID,
+// it is removed from the CrossCerts of the other CA
+func (mgr *BasicManager) RevokeCrossCert(caID, otherCaID string, revocation *types.Revocation) error {
+	ca, err := mgr.GetCA(caID)
+	if err != nil {
+		return err
+	}
+	if _, ok := ca.CrossSigned[otherCaID]; !ok {
+		return fmt.Errorf("%v is not cross-signed by %v", otherCaID, caID)
+	}
+	other, err := mgr.GetCA(otherCaID)
+	if err != nil {
+		return err
+	}
+	record, err := newRevocation(revocation)
+	if err != nil {
+		return err
+	}
+	if err = mgr.revokeCrossCert(ca, other, record); err != nil {
+		return err
+	}
+	return mgr.store.SaveCA(ca)
+}
+
+// revokeCrossCert adds the certificate ca has issued for other to the revocations of ca
+// and removes it from both CA's, the caller has to save ca
+func (mgr *BasicManager) revokeCrossCert(ca, other *types.CAEntity, record *types.Revocation) error {
+	cert, err := entity.ParseCertificatePEM([]byte(other.CrossCerts[ca.ID]))
+	if err != nil {
+		return err
+	}
+	delete(other.CrossCerts, ca.ID)
+	if err = mgr.store.SaveCA(other); err != nil {
+		return err
+	}
+	delete(ca.CrossSigned, other.ID)
+	record.Serial = cert.SerialNumber
+	addRevocation(ca, record)
+	return nil
+}
@@ -0,0 +1,46 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/trusch/pkid/entity"
+	"github.com/trusch/pkid/types"
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+// GetPKCS12 returns the key and certificate of an entity together with the certificates of all its issuers
+// as password protected PKCS#12 file. Legacy selects 3DES/RC2 encryption for old keystores,
+// otherwise AES-256 with PBKDF2 is used.
+func (mgr *BasicManager) GetPKCS12(caID string, typ types.EntityType, id, password string, legacy bool) ([]byte, error) {
+	if password == "" {
+		return nil, errors.New("no password given")
+	}
+	ca, err := mgr.GetCA(caID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := children(ca, typ)[id]; !ok {
+		return nil, fmt.Errorf("%v is not issued by %v", id, caID)
+	}
+	e, err := mgr.loadEntity(typ, id)
+	if err != nil {
+		return nil, err
+	}
+	if e.Key == "" {
+		return nil, errors.New("no private key stored")
+	}
+	leaf, err := entity.NewEntityFromPEM([]byte(e.Cert), []byte(e.Key))
+	if err != nil {
+		return nil, err
+	}
+	chain, err := mgr.issuerChain(ca)
+	if err != nil {
+		return nil, err
+	}
+	encoder := pkcs12.Modern
+	if legacy {
+		encoder = pkcs12.LegacyRC2
+	}
+	return encoder.Encode(leaf.Key, leaf.Cert, chain, password)
+}
@@ -0,0 +1,182 @@
+package manager
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/trusch/pkid/entity"
+	"github.com/trusch/pkid/generator"
+	"github.com/trusch/pkid/types"
+)
+
+// ImportCA imports an existing CA certificate together with its private key.
+// If parentID is set the certificate has to be signed by that CA and becomes its sub CA.
+// Serials issued outside of pkid are unknown, so imported CA's always use random serials.
+func (mgr *BasicManager) ImportCA(parentID string, certPEM, keyPEM []byte, config *types.CAConfig) (string, error) {
+	e, err := entity.NewEntityFromPEM(certPEM, keyPEM)
+	if err != nil {
+		return "", err
+	}
+	if err = e.CheckKey(); err != nil {
+		return "", err
+	}
+	cert := e.Cert
+	if !cert.BasicConstraintsValid || !cert.IsCA {
+		return "", errors.New("certificate is not a CA certificate")
+	}
+	if cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return "", errors.New("certificate is not allowed to sign certificates")
+	}
+	if err = importedSerialStrategy(config); err != nil {
+		return "", err
+	}
+	if err = validateCAConfig(config); err != nil {
+		return "", err
+	}
+	algo, _ := generator.ParseSignatureAlgorithm(config.SignatureAlgorithm)
+	if err = generator.CheckSignatureAlgorithm(algo, cert.PublicKey); err != nil {
+		return "", err
+	}
+	var parent *types.CAEntity
+	if parentID != "" {
+		parent, err = mgr.GetCA(parentID)
+		if err != nil {
+			return "", err
+		}
+		parentCert, err := entity.ParseCertificatePEM([]byte(parent.Cert))
+		if err != nil {
+			return "", err
+		}
+		if err = cert.CheckSignatureFrom(parentCert); err != nil {
+			return "", fmt.Errorf("certificate is not signed by %v: %v", parentID, err)
+		}
+	}
+	certOut, err := e.GetCertAsPEM()
+	if err != nil {
+		return "", err
+	}
+	keyOut, err := e.GetKeyAsPEM()
+	if err != nil {
+		return "", err
+	}
+	subject := generator.OptionsFromCertificate(cert).Subject
+	subject.SerialNumber = ""
+	ca := &types.CAEntity{
+		Entity: &types.Entity{
+			ID:   mgr.store.GetID(),
+			Name: cert.Subject.CommonName,
+			Cert: string(certOut),
+			Key:  string(keyOut),
+		},
+		Parent:         parentID,
+		Imported:       true,
+		Subject:        &subject,
+		Config:         *config,
+		Serial:         big.NewInt(1),
+		SerialsIndexed: true,
+	}
+	if err = mgr.store.SaveCA(ca); err != nil {
+		return "", err
+	}
+	if parent != nil {
+		if parent.CAs == nil {
+			parent.CAs = make(map[string]string)
+		}
+		parent.CAs[ca.ID] = ca.Name
+		if err = mgr.register(parent, ca.Entity); err != nil {
+			return "", err
+		}
+	}
+	return ca.ID, nil
+}
+
+// importedSerialStrategy defaults the serial strategy of imported CA's to random. The sequential strategy is refused,
+// it would issue the serials the CA has already used outside of pkid.
+func importedSerialStrategy(config *types.CAConfig) error {
+	switch config.SerialStrategy {
+	case "":
+		config.SerialStrategy = "random"
+	case "sequential":
+		return errors.New("imported CA's can not use sequential serials, the serials they issued outside of pkid are unknown")
+	}
+	return nil
+}
+
+// ImportCertificate registers a certificate the CA caID has issued outside of pkid, so it is listed
+// and can be revoked. The private key is optional, CA certificates have to be imported with ImportCA.
+func (mgr *BasicManager) ImportCertificate(caID string, typ types.EntityType, certPEM, keyPEM []byte) (string, error) {
+	if typ == types.CA {
+		return "", errors.New("CA certificates have to be imported as CA")
+	}
+	ca, err := mgr.GetCA(caID)
+	if err != nil {
+		return "", err
+	}
+	cert, err := entity.ParseCertificatePEM(certPEM)
+	if err != nil {
+		return "", err
+	}
+	if cert.IsCA {
+		return "", errors.New("CA certificates have to be imported as CA")
+	}
+	caCert, err := entity.ParseCertificatePEM([]byte(ca.Cert))
+	if err != nil {
+		return "", err
+	}
+	if err = cert.CheckSignatureFrom(caCert); err != nil {
+		return "", fmt.Errorf("certificate is not signed by %v: %v", caID, err)
+	}
+	e := &types.Entity{Name: cert.Subject.CommonName}
+	if len(keyPEM) > 0 {
+		withKey, err := entity.NewEntityFromPEM(certPEM, keyPEM)
+		if err != nil {
+			return "", err
+		}
+		if err = withKey.CheckKey(); err != nil {
+			return "", err
+		}
+		key, err := withKey.GetKeyAsPEM()
+		if err != nil {
+			return "", err
+		}
+		e.Key = string(key)
+	}
+	if e.Name == "" && len(cert.DNSNames) > 0 {
+		e.Name = cert.DNSNames[0]
+	}
+	if err = mgr.migrateSerialIndex(ca); err != nil {
+		return "", err
+	}
+	if other, err := mgr.store.LoadSerial(ca.ID, cert.SerialNumber); err == nil {
+		return "", fmt.Errorf("serial %v is already used by %v", cert.SerialNumber, other)
+	}
+	certOut, err := (&entity.Entity{Cert: cert}).GetCertAsPEM()
+	if err != nil {
+		return "", err
+	}
+	e.Cert = string(certOut)
+	e.ID = mgr.store.GetID()
+	if err = mgr.saveEntity(typ, e); err != nil {
+		return "", err
+	}
+	switch typ {
+	case types.Client:
+		if ca.Clients == nil {
+			ca.Clients = make(map[string]string)
+		}
+		ca.Clients[e.ID] = e.Name
+	case types.Server:
+		if ca.Servers == nil {
+			ca.Servers = make(map[string]string)
+		}
+		ca.Servers[e.ID] = e.Name
+	case types.Issued:
+		if ca.Issued == nil {
+			ca.Issued = make(map[string]string)
+		}
+		ca.Issued[e.ID] = e.Name
+	}
+	return e.ID, mgr.register(ca, e)
+}
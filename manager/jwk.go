@@ -0,0 +1,78 @@
+package manager
+
+import (
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/trusch/pkid/entity"
+	"github.com/trusch/pkid/types"
+)
+
+// GetJWK returns the public key of an entity as JWK with the certificate chain up to the last intermediate as x5c
+func (mgr *BasicManager) GetJWK(caID string, typ types.EntityType, id string) (*entity.JWK, error) {
+	ca, err := mgr.GetCA(caID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := children(ca, typ)[id]; !ok {
+		return nil, fmt.Errorf("%v is not issued by %v", id, caID)
+	}
+	e, err := mgr.loadEntity(typ, id)
+	if err != nil {
+		return nil, err
+	}
+	return mgr.jwk(ca, e)
+}
+
+// GetJWKS returns the JWK's of all valid, not revoked client, server and profile based certificates of a CA
+func (mgr *BasicManager) GetJWKS(caID string) (*entity.JWKSet, error) {
+	ca, err := mgr.GetCA(caID)
+	if err != nil {
+		return nil, err
+	}
+	set := &entity.JWKSet{Keys: []*entity.JWK{}}
+	now := time.Now()
+	for _, typ := range []types.EntityType{types.Client, types.Server, types.Issued} {
+		ids := make([]string, 0, len(children(ca, typ)))
+		for id := range children(ca, typ) {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			e, err := mgr.loadEntity(typ, id)
+			if err != nil {
+				return nil, err
+			}
+			if e.IsRevoked {
+				continue
+			}
+			cert, err := entity.ParseCertificatePEM([]byte(e.Cert))
+			if err != nil {
+				return nil, err
+			}
+			if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+				continue
+			}
+			jwk, err := mgr.jwk(ca, e)
+			if err != nil {
+				return nil, err
+			}
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set, nil
+}
+
+func (mgr *BasicManager) jwk(ca *types.CAEntity, e *types.Entity) (*entity.JWK, error) {
+	cert, err := entity.ParseCertificatePEM([]byte(e.Cert))
+	if err != nil {
+		return nil, err
+	}
+	chain, err := mgr.issuerChain(ca)
+	if err != nil {
+		return nil, err
+	}
+	return entity.NewJWK(cert.PublicKey, append([]*x509.Certificate{cert}, withoutRoot(chain)...))
+}
@@ -0,0 +1,107 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/trusch/pkid/entity"
+	"github.com/trusch/pkid/generator"
+	"github.com/trusch/pkid/types"
+)
+
+func validateCAConfig(config *types.CAConfig) error {
+	switch config.ValidityPolicy {
+	case "", "clamp", "reject":
+	default:
+		return fmt.Errorf("unknown validity policy %v (try clamp or reject)", config.ValidityPolicy)
+	}
+	if err := validateSerialStrategy(config.SerialStrategy); err != nil {
+		return err
+	}
+	if _, err := generator.ParseSignatureAlgorithm(config.SignatureAlgorithm); err != nil {
+		return err
+	}
+	for _, u := range []string{config.CRLURL, config.IssuerURL, config.OCSPURL} {
+		if u == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u); err != nil || !parsed.IsAbs() {
+			return fmt.Errorf("invalid url %v", u)
+		}
+	}
+	if _, err := parseDuration(config.MaxValidFor); err != nil {
+		return err
+	}
+	if _, err := parseDuration(config.MaxBackdate); err != nil {
+		return err
+	}
+	crlValidity, crlInterval, deltaCRLValidity, err := crlTimes(config)
+	if err != nil {
+		return err
+	}
+	if crlInterval > crlValidity {
+		return fmt.Errorf("crl interval %v exceeds the crl validity %v", crlInterval, crlValidity)
+	}
+	if crlValidity <= 0 || crlInterval < 0 || deltaCRLValidity <= 0 {
+		return errors.New("crl durations have to be positive")
+	}
+	return nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// applyValidityPolicy makes sure the validity requested in options lies within
+// the validity of the issuing CA and its configured limits. Depending on the
+// CA's validity policy the validity is clamped or the request is rejected.
+func applyValidityPolicy(ca *types.CAEntity, options *generator.Options) error {
+	if ca == nil {
+		return nil
+	}
+	issuer, err := entity.ParseCertificatePEM([]byte(ca.Cert))
+	if err != nil {
+		return err
+	}
+	options.FillDefaults()
+	reject := ca.Config.ValidityPolicy == "reject"
+	now := time.Now()
+	notAfter := options.NotBefore.Add(options.ValidFor)
+
+	maxBackdate, _ := parseDuration(ca.Config.MaxBackdate)
+	if maxBackdate > 0 && options.NotBefore.Before(now.Add(-maxBackdate)) {
+		if reject {
+			return fmt.Errorf("notBefore %v is backdated more than %v", options.NotBefore, maxBackdate)
+		}
+		options.NotBefore = now.Add(-maxBackdate)
+	}
+	if options.NotBefore.Before(issuer.NotBefore) {
+		if reject {
+			return fmt.Errorf("notBefore %v is before the notBefore of the issuing CA (%v)", options.NotBefore, issuer.NotBefore)
+		}
+		options.NotBefore = issuer.NotBefore
+	}
+	maxValidFor, _ := parseDuration(ca.Config.MaxValidFor)
+	if maxValidFor > 0 && notAfter.Sub(options.NotBefore) > maxValidFor {
+		if reject {
+			return fmt.Errorf("validity exceeds the maximum of the issuing CA (%v)", maxValidFor)
+		}
+		notAfter = options.NotBefore.Add(maxValidFor)
+	}
+	if notAfter.After(issuer.NotAfter) {
+		if reject {
+			return fmt.Errorf("notAfter %v is after the notAfter of the issuing CA (%v)", notAfter, issuer.NotAfter)
+		}
+		notAfter = issuer.NotAfter
+	}
+	if !notAfter.After(options.NotBefore) {
+		return fmt.Errorf("no validity left within the limits of the issuing CA")
+	}
+	options.ValidFor = notAfter.Sub(options.NotBefore)
+	return nil
+}
@@ -0,0 +1,125 @@
+package manager
+
+import (
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/trusch/pkid/generator"
+	"github.com/trusch/pkid/types"
+)
+
+// builtinProfiles are available unless a stored profile with the same name exists
+var builtinProfiles = map[string]*types.Profile{
+	"web-server": {
+		Name:        "web-server",
+		KeyUsage:    []string{"digitalSignature", "keyEncipherment"},
+		ExtKeyUsage: []string{"serverAuth"},
+		MaxValidity: "9528h",
+	},
+	"mtls-peer": {
+		Name:        "mtls-peer",
+		KeyUsage:    []string{"digitalSignature", "keyEncipherment"},
+		ExtKeyUsage: []string{"serverAuth", "clientAuth"},
+		MaxValidity: "8760h",
+	},
+	"code-signing": {
+		Name:        "code-signing",
+		KeyUsage:    []string{"digitalSignature"},
+		ExtKeyUsage: []string{"codeSigning"},
+		MaxValidity: "26280h",
+	},
+	"smime": {
+		Name:        "smime",
+		KeyUsage:    []string{"digitalSignature", "keyEncipherment"},
+		ExtKeyUsage: []string{"emailProtection"},
+		MaxValidity: "17520h",
+	},
+	"ocsp-signer": {
+		Name:        "ocsp-signer",
+		KeyUsage:    []string{"digitalSignature"},
+		ExtKeyUsage: []string{"ocspSigning"},
+		MaxValidity: "2160h",
+		// id-pkix-ocsp-nocheck with a NULL value
+		Extensions: []types.Extension{{ID: "1.3.6.1.5.5.7.48.1.5", Value: []byte{0x05, 0x00}}},
+	},
+}
+
+func validateProfile(profile *types.Profile) error {
+	if profile.Name == "" {
+		return errors.New("profile has no name")
+	}
+	if _, err := generator.ParseKeyUsage(profile.KeyUsage); err != nil {
+		return err
+	}
+	if _, err := generator.ParseExtKeyUsage(profile.ExtKeyUsage); err != nil {
+		return err
+	}
+	for _, algo := range profile.KeyAlgorithms {
+		switch algo {
+		case "rsa", "ecdsa", "ed25519":
+		default:
+			return fmt.Errorf("unknown key algorithm %v", algo)
+		}
+	}
+	if profile.MaxValidity != "" {
+		if _, err := time.ParseDuration(profile.MaxValidity); err != nil {
+			return err
+		}
+	}
+	if _, err := profileExtensions(profile); err != nil {
+		return err
+	}
+	return generator.ValidatePolicies(profile.Policies)
+}
+
+// applyProfile checks the options against the profile and sets usages and extensions
+func applyProfile(profile *types.Profile, options *generator.Options) error {
+	if err := validateProfile(profile); err != nil {
+		return err
+	}
+	if len(profile.KeyAlgorithms) > 0 {
+		allowed := false
+		for _, algo := range profile.KeyAlgorithms {
+			if algo == options.KeyAlgorithm() {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("key algorithm %v is not allowed by profile %v", options.KeyAlgorithm(), profile.Name)
+		}
+	}
+	if profile.MaxValidity != "" {
+		maxValidity, _ := time.ParseDuration(profile.MaxValidity)
+		if options.ValidFor > maxValidity {
+			return fmt.Errorf("validity %v exceeds the maximum of profile %v (%v)", options.ValidFor, profile.Name, maxValidity)
+		}
+		if options.ValidFor == 0 && maxValidity < 365*24*time.Hour {
+			options.ValidFor = maxValidity
+		}
+	}
+	if len(options.ExtraExtensions) > 0 {
+		return fmt.Errorf("custom extensions can not be added to certificates of profile %v, they have to be part of the profile", profile.Name)
+	}
+	options.IsCA = false
+	options.KeyUsage, _ = generator.ParseKeyUsage(profile.KeyUsage)
+	options.ExtKeyUsages, _ = generator.ParseExtKeyUsage(profile.ExtKeyUsage)
+	options.Policies = append(options.Policies, profile.Policies...)
+	options.MustStaple = options.MustStaple || profile.MustStaple
+	options.ExtraExtensions, _ = profileExtensions(profile)
+	return nil
+}
+
+// profileExtensions returns the extensions of a profile, they must not replace extensions generated by pkid
+func profileExtensions(profile *types.Profile) ([]pkix.Extension, error) {
+	exts := make([]pkix.Extension, len(profile.Extensions))
+	for idx, ext := range profile.Extensions {
+		oid, err := generator.ParseOID(ext.ID)
+		if err != nil {
+			return nil, err
+		}
+		exts[idx] = pkix.Extension{Id: oid, Critical: ext.Critical, Value: ext.Value}
+	}
+	return exts, generator.ValidateExtensions(exts)
+}
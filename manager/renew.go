@@ -0,0 +1,133 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/trusch/pkid/entity"
+	"github.com/trusch/pkid/generator"
+	"github.com/trusch/pkid/types"
+)
+
+// Renew issues a new certificate for the key of an existing entity.
+// Subject, subject alternative names and extensions are taken over from the current certificate,
+// options only supply the validity. The entity keeps its ID, the current certificate is kept in
+// PreviousCerts and revoked if revokeOld is set.
+func (mgr *BasicManager) Renew(caID string, typ types.EntityType, id string, options *generator.Options, revokeOld bool) error {
+	return mgr.reissue(caID, typ, id, options, revokeOld, false)
+}
+
+// Rekey works like Renew but generates a new key, options may select the key parameters.
+// By default a key of the same kind as the current one is generated.
+func (mgr *BasicManager) Rekey(caID string, typ types.EntityType, id string, options *generator.Options, revokeOld bool) error {
+	if typ == types.CA {
+		return errors.New("rekeying a CA is not supported, create a new CA instead")
+	}
+	return mgr.reissue(caID, typ, id, options, revokeOld, true)
+}
+
+func (mgr *BasicManager) reissue(caID string, typ types.EntityType, id string, options *generator.Options, revokeOld, rekey bool) error {
+	ca, err := mgr.GetCA(caID)
+	if err != nil {
+		return err
+	}
+	if _, ok := children(ca, typ)[id]; !ok {
+		return fmt.Errorf("%v is not issued by %v", id, caID)
+	}
+	e, err := mgr.loadEntity(typ, id)
+	if err != nil {
+		return err
+	}
+	if e.IsRevoked {
+		return errors.New("can not renew a revoked entity")
+	}
+	if rekey && e.Key == "" {
+		return errors.New("no private key stored, submit a new certificate signing request instead")
+	}
+	old, err := entity.ParseCertificatePEM([]byte(e.Cert))
+	if err != nil {
+		return err
+	}
+	newOptions := generator.OptionsFromCertificate(old)
+	newOptions.NotBefore = options.NotBefore
+	newOptions.ValidFor = options.ValidFor
+	if newOptions.ValidFor == 0 {
+		newOptions.ValidFor = old.NotAfter.Sub(old.NotBefore)
+	}
+	if rekey {
+		newOptions.SetKeyParameters(old.PublicKey)
+		if options.KeyType != "" || options.RsaBits != 0 || options.Curve != "" {
+			newOptions.KeyType, newOptions.RsaBits, newOptions.Curve = options.KeyType, options.RsaBits, options.Curve
+		}
+	} else {
+		newOptions.PublicKey = old.PublicKey
+	}
+	renewed, err := mgr.sign(ca, newOptions)
+	if err != nil {
+		return err
+	}
+	e.PreviousCerts = append(e.PreviousCerts, e.Cert)
+	e.Cert = renewed.Cert
+	if rekey {
+		e.Key = renewed.Key
+	}
+	if err = mgr.saveEntity(typ, e); err != nil {
+		return err
+	}
+	if revokeOld {
+		addRevocation(ca, &types.Revocation{Serial: old.SerialNumber, Time: time.Now(), Reason: reasonSuperseded})
+	}
+	return mgr.register(ca, e)
+}
+
+func children(ca *types.CAEntity, typ types.EntityType) map[string]string {
+	switch typ {
+	case types.CA:
+		return ca.CAs
+	case types.Client:
+		return ca.Clients
+	case types.Server:
+		return ca.Servers
+	case types.Issued:
+		return ca.Issued
+	}
+	return nil
+}
+
+func (mgr *BasicManager) loadEntity(typ types.EntityType, id string) (*types.Entity, error) {
+	switch typ {
+	case types.CA:
+		ca, err := mgr.store.LoadCA(id)
+		if err != nil {
+			return nil, err
+		}
+		return ca.Entity, nil
+	case types.Client:
+		return mgr.store.LoadClient(id)
+	case types.Server:
+		return mgr.store.LoadServer(id)
+	case types.Issued:
+		return mgr.store.LoadIssued(id)
+	}
+	return nil, fmt.Errorf("unknown entity type %v", typ)
+}
+
+func (mgr *BasicManager) saveEntity(typ types.EntityType, e *types.Entity) error {
+	switch typ {
+	case types.CA:
+		ca, err := mgr.store.LoadCA(e.ID)
+		if err != nil {
+			return err
+		}
+		ca.Entity = e
+		return mgr.store.SaveCA(ca)
+	case types.Client:
+		return mgr.store.SaveClient(e)
+	case types.Server:
+		return mgr.store.SaveServer(e)
+	case types.Issued:
+		return mgr.store.SaveIssued(e)
+	}
+	return fmt.Errorf("unknown entity type %v", typ)
+}
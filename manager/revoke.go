@@ -0,0 +1,256 @@
+package manager
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/trusch/pkid/types"
+)
+
+// CRL reason codes (RFC 5280, 5.3.1)
+const (
+	reasonUnspecified = iota
+	reasonKeyCompromise
+	reasonCACompromise
+	reasonAffiliationChanged
+	reasonSuperseded
+	reasonCessationOfOperation
+	reasonCertificateHold
+	_ // 7 is not used
+	_ // removeFromCRL is only allowed in delta CRL's
+	reasonPrivilegeWithdrawn
+	reasonAACompromise
+)
+
+var revocationReasons = map[string]int{
+	"unspecified":          reasonUnspecified,
+	"keyCompromise":        reasonKeyCompromise,
+	"cACompromise":         reasonCACompromise,
+	"affiliationChanged":   reasonAffiliationChanged,
+	"superseded":           reasonSuperseded,
+	"cessationOfOperation": reasonCessationOfOperation,
+	"certificateHold":      reasonCertificateHold,
+	"privilegeWithdrawn":   reasonPrivilegeWithdrawn,
+	"aACompromise":         reasonAACompromise,
+}
+
+// ParseRevocationReason returns the CRL reason code for its RFC 5280 name, e.g. keyCompromise
+func ParseRevocationReason(name string) (int, error) {
+	for reasonName, reason := range revocationReasons {
+		if strings.EqualFold(name, reasonName) {
+			return reason, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown revocation reason %v (try keyCompromise, superseded or cessationOfOperation)", name)
+}
+
+// Revoke revokes a certificate issued by a CA. Serial, Time and Reason of revocation
+// are filled in by Revoke, the time defaults to now, the reason to unspecified.
+func (mgr *BasicManager) Revoke(caID string, typ types.EntityType, id string, revocation *types.Revocation) error {
+	ca, err := mgr.GetCA(caID)
+	if err != nil {
+		return err
+	}
+	if _, ok := children(ca, typ)[id]; !ok {
+		return fmt.Errorf("%v is not issued by %v", id, caID)
+	}
+	e, err := mgr.loadEntity(typ, id)
+	if err != nil {
+		return err
+	}
+	record, err := newRevocation(revocation)
+	if err != nil {
+		return err
+	}
+	record.Serial, err = mgr.getSerialFromEntity(e)
+	if err != nil {
+		return err
+	}
+	e.IsRevoked = true
+	if err = mgr.saveEntity(typ, e); err != nil {
+		return err
+	}
+	addRevocation(ca, record)
+	return mgr.store.SaveCA(ca)
+}
+
+// RevokeCACascading revokes a sub CA together with everything issued below it:
+// sub CA's, cross-signed certificates, clients, servers, profile based and OpenSSH certificates.
+// The sub CA is revoked with the given revocation (reason defaults to cACompromise),
+// all certificates below it with reason cACompromise.
+func (mgr *BasicManager) RevokeCACascading(caID, id string, revocation *types.Revocation) error {
+	ca, err := mgr.GetCA(caID)
+	if err != nil {
+		return err
+	}
+	if _, ok := ca.CAs[id]; !ok {
+		return fmt.Errorf("%v is not issued by %v", id, caID)
+	}
+	subCa, err := mgr.GetCA(id)
+	if err != nil {
+		return err
+	}
+	record, err := newRevocation(revocation)
+	if err != nil {
+		return err
+	}
+	if record.Reason == reasonUnspecified {
+		record.Reason = reasonCACompromise
+	}
+	if err = mgr.revokeDescendants(subCa, record); err != nil {
+		return err
+	}
+	record.Serial, err = mgr.getSerialFromEntity(subCa.Entity)
+	if err != nil {
+		return err
+	}
+	addRevocation(ca, record)
+	return mgr.store.SaveCA(ca)
+}
+
+// revokeDescendants marks the CA and everything it issued revoked, recursing into its sub CA's.
+// The certificates are revoked with reason cACompromise, the other details are taken from template.
+func (mgr *BasicManager) revokeDescendants(ca *types.CAEntity, template *types.Revocation) error {
+	revoke := func(serial *big.Int) {
+		record := *template
+		record.Serial = serial
+		record.Reason = reasonCACompromise
+		addRevocation(ca, &record)
+	}
+	for id := range ca.CAs {
+		subCa, err := mgr.store.LoadCA(id)
+		if err != nil {
+			return err
+		}
+		if err = mgr.revokeDescendants(subCa, template); err != nil {
+			return err
+		}
+		serial, err := mgr.getSerialFromEntity(subCa.Entity)
+		if err != nil {
+			return err
+		}
+		revoke(serial)
+	}
+	for id := range ca.CrossSigned {
+		other, err := mgr.store.LoadCA(id)
+		if err != nil {
+			return err
+		}
+		record := *template
+		record.Reason = reasonCACompromise
+		if err = mgr.revokeCrossCert(ca, other, &record); err != nil {
+			return err
+		}
+	}
+	for _, typ := range []types.EntityType{types.Client, types.Server, types.Issued} {
+		for id := range children(ca, typ) {
+			e, err := mgr.loadEntity(typ, id)
+			if err != nil {
+				return err
+			}
+			if e.IsRevoked {
+				continue
+			}
+			serial, err := mgr.getSerialFromEntity(e)
+			if err != nil {
+				return err
+			}
+			e.IsRevoked = true
+			if err = mgr.saveEntity(typ, e); err != nil {
+				return err
+			}
+			revoke(serial)
+		}
+	}
+	for id := range ca.SSHCerts {
+		cert, err := mgr.store.LoadSSHCert(id)
+		if err != nil {
+			return err
+		}
+		if cert.IsRevoked {
+			continue
+		}
+		cert.IsRevoked = true
+		if err = mgr.store.SaveSSHCert(cert); err != nil {
+			return err
+		}
+		ca.SSHRevoked = append(ca.SSHRevoked, cert.Serial)
+	}
+	ca.IsRevoked = true
+	return mgr.store.SaveCA(ca)
+}
+
+// newRevocation validates the details of a revocation request and returns a record with defaults filled in
+func newRevocation(revocation *types.Revocation) (*types.Revocation, error) {
+	record := &types.Revocation{}
+	if revocation != nil {
+		*record = *revocation
+	}
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	valid := false
+	for _, reason := range revocationReasons {
+		valid = valid || reason == record.Reason
+	}
+	if !valid {
+		return nil, fmt.Errorf("invalid revocation reason %v", record.Reason)
+	}
+	if record.InvalidityDate.After(record.Time) {
+		return nil, errors.New("the invalidity date can not be after the revocation")
+	}
+	return record, nil
+}
+
+// addRevocation puts a revocation on the revocation list of a CA, serials already on it keep their record
+func addRevocation(ca *types.CAEntity, record *types.Revocation) {
+	migrateRevocations(ca)
+	for _, revoked := range ca.Revocations {
+		if revoked.Serial.Cmp(record.Serial) == 0 {
+			return
+		}
+	}
+	ca.Revocations = append(ca.Revocations, record)
+}
+
+// migrateRevocations converts the revoked serials of older versions into revocation records.
+// Their revocation time is unknown, the time of the migration is used so that it stays stable from now on.
+// It returns whether the CA has been changed and needs to be saved.
+func migrateRevocations(ca *types.CAEntity) bool {
+	if len(ca.Revoked) == 0 {
+		return false
+	}
+	now := time.Now()
+	serials := ca.Revoked
+	ca.Revoked = nil
+	for _, serial := range serials {
+		addRevocation(ca, &types.Revocation{Serial: serial, Time: now})
+	}
+	return true
+}
+
+// oidInvalidityDate is the CRL entry extension for the date a key is known or suspected to be compromised
+var oidInvalidityDate = asn1.ObjectIdentifier{2, 5, 29, 24}
+
+// revocationListEntry renders a revocation record as CRL entry with reason code and invalidity date
+func revocationListEntry(revocation *types.Revocation) (x509.RevocationListEntry, error) {
+	entry := x509.RevocationListEntry{
+		SerialNumber:   revocation.Serial,
+		RevocationTime: revocation.Time,
+		ReasonCode:     revocation.Reason,
+	}
+	if !revocation.InvalidityDate.IsZero() {
+		value, err := asn1.MarshalWithParams(revocation.InvalidityDate.UTC(), "generalized")
+		if err != nil {
+			return entry, err
+		}
+		entry.ExtraExtensions = append(entry.ExtraExtensions, pkix.Extension{Id: oidInvalidityDate, Value: value})
+	}
+	return entry, nil
+}
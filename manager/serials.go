@@ -0,0 +1,98 @@
+package manager
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/trusch/pkid/types"
+)
+
+// randomSerialBits is the size of random serial numbers, CA/B Forum requires at least 64 bits of entropy
+const randomSerialBits = 128
+
+func validateSerialStrategy(strategy string) error {
+	switch strategy {
+	case "", "sequential", "random":
+		return nil
+	}
+	return fmt.Errorf("unknown serial strategy %v (try sequential or random)", strategy)
+}
+
+// nextSerial returns a serial number which is not yet used by the CA.
+// For the sequential strategy the counter of the CA is advanced, the caller has to save the CA.
+func (mgr *BasicManager) nextSerial(ca *types.CAEntity) (*big.Int, error) {
+	if err := mgr.migrateSerialIndex(ca); err != nil {
+		return nil, err
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), randomSerialBits)
+	for i := 0; i < 100; i++ {
+		var serial *big.Int
+		switch ca.Config.SerialStrategy {
+		case "random":
+			s, err := rand.Int(rand.Reader, limit)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate serial number: %s", err)
+			}
+			if s.Sign() == 0 {
+				continue
+			}
+			serial = s
+		default:
+			serial = new(big.Int).Set(ca.Serial)
+			ca.Serial.Add(ca.Serial, big.NewInt(1))
+		}
+		if _, err := mgr.store.LoadSerial(ca.ID, serial); err != nil {
+			return serial, nil
+		}
+	}
+	return nil, errors.New("failed to find an unused serial number")
+}
+
+// migrateSerialIndex indexes the serials of all certificates a CA has issued before the serial index existed
+// and moves the sequential counter behind the highest serial in use
+func (mgr *BasicManager) migrateSerialIndex(ca *types.CAEntity) error {
+	if ca.SerialsIndexed {
+		return nil
+	}
+	children := []struct {
+		ids  map[string]string
+		load func(id string) (*types.Entity, error)
+	}{
+		{ca.CAs, func(id string) (*types.Entity, error) {
+			sub, err := mgr.store.LoadCA(id)
+			if err != nil {
+				return nil, err
+			}
+			return sub.Entity, nil
+		}},
+		{ca.Clients, mgr.store.LoadClient},
+		{ca.Servers, mgr.store.LoadServer},
+		{ca.Issued, mgr.store.LoadIssued},
+	}
+	for _, child := range children {
+		for id := range child.ids {
+			e, err := child.load(id)
+			if err != nil {
+				return err
+			}
+			serial, err := mgr.getSerialFromEntity(e)
+			if err != nil {
+				return err
+			}
+			if other, err := mgr.store.LoadSerial(ca.ID, serial); err == nil && other != id {
+				log.Printf("CA %v: serial %v is used by %v and %v", ca.ID, serial, other, id)
+			}
+			if err = mgr.store.SaveSerial(ca.ID, serial, id); err != nil {
+				return err
+			}
+			if serial.Cmp(ca.Serial) >= 0 {
+				ca.Serial = new(big.Int).Add(serial, big.NewInt(1))
+			}
+		}
+	}
+	ca.SerialsIndexed = true
+	return mgr.store.SaveCA(ca)
+}
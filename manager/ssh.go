@@ -0,0 +1,142 @@
+package manager
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/trusch/pkid/entity"
+	"github.com/trusch/pkid/generator"
+	"github.com/trusch/pkid/types"
+	"golang.org/x/crypto/ssh"
+)
+
+// GetSSHPublicKey returns the public key of a CA in authorized_keys format
+func (mgr *BasicManager) GetSSHPublicKey(caID string) (string, error) {
+	ca, err := mgr.GetCA(caID)
+	if err != nil {
+		return "", err
+	}
+	signer, err := generator.NewSSHSigner(ca)
+	if err != nil {
+		return "", err
+	}
+	return string(ssh.MarshalAuthorizedKey(signer.PublicKey())), nil
+}
+
+// SignSSHKey signs an OpenSSH certificate with the key of a CA.
+// The validity is limited like the validity of X.509 certificates of the CA.
+func (mgr *BasicManager) SignSSHKey(caID string, options *generator.SSHOptions) (string, error) {
+	ca, err := mgr.GetCA(caID)
+	if err != nil {
+		return "", err
+	}
+	if ca.IsRevoked {
+		return "", errors.New("the CA is revoked and can not issue certificates")
+	}
+	validity := &generator.Options{NotBefore: options.ValidAfter, ValidFor: options.ValidFor}
+	if err = applyValidityPolicy(ca, validity); err != nil {
+		return "", err
+	}
+	options.ValidAfter, options.ValidFor = validity.NotBefore, validity.ValidFor
+	serial, err := nextSSHSerial(ca)
+	if err != nil {
+		return "", err
+	}
+	options.Serial = serial
+	if err = mgr.store.SaveCA(ca); err != nil {
+		return "", err
+	}
+	cert, err := generator.GenerateSSHCertificate(ca, options)
+	if err != nil {
+		return "", err
+	}
+	sshCert := &types.SSHCert{
+		ID:     mgr.store.GetID(),
+		KeyID:  cert.KeyId,
+		Serial: cert.Serial,
+		Cert:   string(ssh.MarshalAuthorizedKey(cert)),
+	}
+	if err = mgr.store.SaveSSHCert(sshCert); err != nil {
+		return "", err
+	}
+	if ca.SSHCerts == nil {
+		ca.SSHCerts = make(map[string]string)
+	}
+	ca.SSHCerts[sshCert.ID] = sshCert.KeyID
+	if err = mgr.store.SaveCA(ca); err != nil {
+		return "", err
+	}
+	return sshCert.ID, nil
+}
+
+// nextSSHSerial returns the serial for the next OpenSSH certificate of a CA, the caller has to save the CA
+func nextSSHSerial(ca *types.CAEntity) (uint64, error) {
+	if ca.Config.SerialStrategy == "random" {
+		buf := make([]byte, 8)
+		for {
+			if _, err := rand.Read(buf); err != nil {
+				return 0, fmt.Errorf("failed to generate serial number: %s", err)
+			}
+			if serial := binary.BigEndian.Uint64(buf); serial != 0 {
+				return serial, nil
+			}
+		}
+	}
+	// serial 0 can not be revoked by a KRL
+	if ca.SSHSerial == 0 {
+		ca.SSHSerial = 1
+	}
+	serial := ca.SSHSerial
+	ca.SSHSerial++
+	return serial, nil
+}
+
+// GetSSHCert returns an OpenSSH certificate signed by a CA
+func (mgr *BasicManager) GetSSHCert(caID, id string) (*types.SSHCert, error) {
+	ca, err := mgr.GetCA(caID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ca.SSHCerts[id]; !ok {
+		return nil, fmt.Errorf("%v is not signed by %v", id, caID)
+	}
+	return mgr.store.LoadSSHCert(id)
+}
+
+// RevokeSSHCert adds the serial of an OpenSSH certificate to the KRL of its CA
+func (mgr *BasicManager) RevokeSSHCert(caID, id string) error {
+	ca, err := mgr.GetCA(caID)
+	if err != nil {
+		return err
+	}
+	cert, err := mgr.GetSSHCert(caID, id)
+	if err != nil {
+		return err
+	}
+	if cert.IsRevoked {
+		return nil
+	}
+	cert.IsRevoked = true
+	if err = mgr.store.SaveSSHCert(cert); err != nil {
+		return err
+	}
+	ca.SSHRevoked = append(ca.SSHRevoked, cert.Serial)
+	return mgr.store.SaveCA(ca)
+}
+
+// GetKRL returns the OpenSSH key revocation list of a CA
+func (mgr *BasicManager) GetKRL(caID string) ([]byte, error) {
+	ca, err := mgr.GetCA(caID)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := generator.NewSSHSigner(ca)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return entity.EncodeKRL(signer.PublicKey(), ca.SSHRevoked, uint64(now.Unix()), now), nil
+}
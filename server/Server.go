@@ -1,16 +1,24 @@
 package server
 
 import (
+	"crypto/x509/pkix"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/trusch/pkid/entity"
 	"github.com/trusch/pkid/generator"
 	"github.com/trusch/pkid/manager"
 	"github.com/trusch/pkid/types"
@@ -20,6 +28,9 @@ type Server struct {
 	mgr    manager.Manager
 	ln     net.Listener
 	server *http.Server
+
+	// RequireEncryptedKeys forbids downloading private keys without passphrase
+	RequireEncryptedKeys bool
 }
 
 type entityType string
@@ -28,8 +39,17 @@ const (
 	clientType entityType = "client"
 	serverType entityType = "server"
 	caType     entityType = "ca"
+	issuedType entityType = "issued"
+	sshType    entityType = "ssh"
 )
 
+var storageTypes = map[entityType]types.EntityType{
+	caType:     types.CA,
+	clientType: types.Client,
+	serverType: types.Server,
+	issuedType: types.Issued,
+}
+
 func New(addr string, mgr manager.Manager) *Server {
 	srv := &http.Server{
 		Addr:           addr,
@@ -38,7 +58,7 @@ func New(addr string, mgr manager.Manager) *Server {
 		WriteTimeout:   10 * time.Second,
 		MaxHeaderBytes: 1 << 20,
 	}
-	server := &Server{mgr, nil, srv}
+	server := &Server{mgr: mgr, server: srv}
 	server.constructRouter()
 	return server
 }
@@ -52,8 +72,9 @@ func (srv *Server) ListenAndServe() error {
 	return srv.server.Serve(ln)
 }
 
+// Stop closes the listener and all open connections
 func (srv *Server) Stop() error {
-	return srv.ln.Close()
+	return srv.server.Close()
 }
 
 func (srv *Server) constructRouter() {
@@ -61,9 +82,73 @@ func (srv *Server) constructRouter() {
 	router.Path("/ca").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		srv.handleCreateSelfSignedCA(w, r)
 	})
+	router.Path("/ca/import").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleImportCA(w, r)
+	})
+	router.Path("/ca/{ca}/issue").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleIssue(w, r)
+	})
+	router.Path("/ca/{ca}/cross-sign/{otherCa}").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleCrossSign(w, r)
+	})
+	router.Path("/ca/{ca}/cross-signed").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleGetCrossCerts(w, r)
+	})
+	router.Path("/ca/{ca}/cross-signed/{otherCa}/revoke").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleRevokeCrossCert(w, r)
+	})
+	// fixed CA routes have to be registered before the routes with an entity type
+	router.Path("/ca/{ca}/cert").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleGetCACert(w, r)
+	})
+	router.Path("/ca/{ca}/key").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleGetCAKey(w, r)
+	})
+	router.Path("/ca/{ca}/config").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleGetCAConfig(w, r)
+	})
+	router.Path("/ca/{ca}/config").Methods("PUT", "POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleUpdateCAConfig(w, r)
+	})
+	router.Path("/ca/{ca}/crl").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleGetCRL(w, r, false)
+	})
+	router.Path("/ca/{ca}/crl/delta").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleGetCRL(w, r, true)
+	})
+	router.Path("/ca/{ca}/bundle").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleGetBundle(w, r)
+	})
+	router.Path("/ca/{ca}/jwks.json").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleGetJWKS(w, r)
+	})
+	router.Path("/ca/{ca}/ssh").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleList(w, r, string(sshType))
+	})
+	router.Path("/ca/{ca}/ssh/ca.pub").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleGetSSHPublicKey(w, r)
+	})
+	router.Path("/ca/{ca}/ssh/krl").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleGetKRL(w, r)
+	})
+	router.Path("/ca/{ca}/ssh/sign").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleSignSSHKey(w, r)
+	})
+	router.Path("/ca/{ca}/ssh/{id}/cert").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleGetSSHCert(w, r)
+	})
+	router.Path("/ca/{ca}/ssh/{id}/revoke").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleRevokeSSHCert(w, r)
+	})
 	router.Path("/ca/{ca}/{typ}").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		srv.handleCreateSigned(w, r)
 	})
+	router.Path("/ca/{ca}/{typ}/import").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleImportCertificate(w, r)
+	})
+	router.Path("/ca/{ca}/{typ}/sign").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleSignCSR(w, r)
+	})
 	router.Path("/ca/{ca}").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		srv.handleGetCA(w, r, "client")
 	})
@@ -76,23 +161,50 @@ func (srv *Server) constructRouter() {
 	router.Path("/ca/{ca}/ca").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		srv.handleList(w, r, "ca")
 	})
+	router.Path("/ca/{ca}/issued").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleList(w, r, "issued")
+	})
+	router.Path("/profile").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleListProfiles(w, r)
+	})
+	router.Path("/profile/{name}").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleGetProfile(w, r)
+	})
+	router.Path("/profile/{name}").Methods("PUT", "POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleSaveProfile(w, r)
+	})
+	router.Path("/profile/{name}").Methods("DELETE").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleDeleteProfile(w, r)
+	})
 	router.Path("/ca/{ca}/{typ}/{id}/cert").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		srv.handleGetCert(w, r)
 	})
 	router.Path("/ca/{ca}/{typ}/{id}/key").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		srv.handleGetKey(w, r)
 	})
+	router.Path("/ca/{ca}/{typ}/{id}/chain").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleGetChain(w, r, false)
+	})
+	router.Path("/ca/{ca}/{typ}/{id}/fullchain").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleGetChain(w, r, true)
+	})
+	router.Path("/ca/{ca}/{typ}/{id}/pkcs12").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleGetPKCS12(w, r)
+	})
+	router.Path("/ca/{ca}/{typ}/{id}/jwk").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleGetJWK(w, r)
+	})
 	router.Path("/ca/{ca}/{typ}/{id}/revoke").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		srv.handleRevoke(w, r)
 	})
-	router.Path("/ca/{ca}/cert").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		srv.handleGetCACert(w, r)
+	router.Path("/ca/{ca}/{typ}/{id}/renew").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleRenew(w, r, false)
 	})
-	router.Path("/ca/{ca}/key").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		srv.handleGetCAKey(w, r)
+	router.Path("/ca/{ca}/{typ}/{id}/rekey").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleRenew(w, r, true)
 	})
-	router.Path("/ca/{ca}/crl").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		srv.handleGetCRL(w, r)
+	router.Path("/ca/{ca}/{typ}/{id}/history").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.handleGetHistory(w, r)
 	})
 	srv.server.Handler = router
 }
@@ -133,6 +245,8 @@ func (srv *Server) handleCreateSigned(w http.ResponseWriter, r *http.Request) {
 		id, err = srv.mgr.CreateClient(ca, options)
 	case serverType:
 		id, err = srv.mgr.CreateServer(ca, options)
+	default:
+		err = fmt.Errorf("unknown entity type %v", vars["typ"])
 	}
 	if err != nil {
 		log.Print(err)
@@ -143,120 +257,430 @@ func (srv *Server) handleCreateSigned(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(id))
 }
 
-func (srv *Server) handleGetCert(w http.ResponseWriter, r *http.Request) {
+func (srv *Server) handleImportCA(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	options, err := srv.parseOptionsFromRequest(r)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	cert, key := splitPEM(body)
+	id, err := srv.mgr.ImportCA(r.FormValue("parent"), cert, key, &options.CAConfig)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write([]byte(id))
+}
+
+func (srv *Server) handleImportCertificate(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	ca := vars["ca"]
-	caEntity, err := srv.mgr.GetCA(ca)
+	typ, ok := storageTypes[entityType(vars["typ"])]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("unknown entity type %v", vars["typ"])))
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<20))
 	if err != nil {
 		log.Print(err)
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte(err.Error()))
 		return
 	}
-	var entity *types.Entity
+	cert, key := splitPEM(body)
+	id, err := srv.mgr.ImportCertificate(vars["ca"], typ, cert, key)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write([]byte(id))
+}
+
+// splitPEM returns the first certificate and all non-certificate blocks (usually the key) of PEM data
+func splitPEM(data []byte) (cert []byte, rest []byte) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return cert, rest
+		}
+		switch {
+		case block.Type != "CERTIFICATE":
+			rest = append(rest, pem.EncodeToMemory(block)...)
+		case cert == nil:
+			cert = pem.EncodeToMemory(block)
+		}
+	}
+}
+
+func (srv *Server) handleIssue(w http.ResponseWriter, r *http.Request) {
+	options, err := srv.parseCreateOptionsFromRequest(r)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	profile := r.FormValue("profile")
+	if profile == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("no profile given"))
+		return
+	}
+	id, err := srv.mgr.Issue(mux.Vars(r)["ca"], profile, options)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write([]byte(id))
+}
+
+func (srv *Server) handleCrossSign(w http.ResponseWriter, r *http.Request) {
+	options, err := srv.parseOptionsFromRequest(r)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	vars := mux.Vars(r)
+	cert, err := srv.mgr.CrossSign(vars["ca"], vars["otherCa"], options)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write([]byte(cert))
+}
+
+func (srv *Server) handleGetCrossCerts(w http.ResponseWriter, r *http.Request) {
+	caEntity, err := srv.mgr.GetCA(mux.Vars(r)["ca"])
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	certs := caEntity.CrossCerts
+	if certs == nil {
+		certs = map[string]string{}
+	}
+	json.NewEncoder(w).Encode(certs)
+}
+
+func (srv *Server) handleRevokeCrossCert(w http.ResponseWriter, r *http.Request) {
+	revocation, err := parseRevocationFromRequest(r)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	vars := mux.Vars(r)
+	if err = srv.mgr.RevokeCrossCert(vars["ca"], vars["otherCa"], revocation); err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write([]byte("revoked"))
+}
+
+func (srv *Server) handleListProfiles(w http.ResponseWriter, r *http.Request) {
+	names, err := srv.mgr.ListProfiles()
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	json.NewEncoder(w).Encode(names)
+}
+
+func (srv *Server) handleGetProfile(w http.ResponseWriter, r *http.Request) {
+	profile, err := srv.mgr.GetProfile(mux.Vars(r)["name"])
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	json.NewEncoder(w).Encode(profile)
+}
+
+func (srv *Server) handleSaveProfile(w http.ResponseWriter, r *http.Request) {
+	profile := &types.Profile{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(profile); err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	profile.Name = mux.Vars(r)["name"]
+	if err := srv.mgr.SaveProfile(profile); err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write([]byte("saved"))
+}
+
+func (srv *Server) handleDeleteProfile(w http.ResponseWriter, r *http.Request) {
+	if err := srv.mgr.DeleteProfile(mux.Vars(r)["name"]); err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write([]byte("deleted"))
+}
+
+func (srv *Server) handleSignCSR(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	csr, err := entity.ParseCertificateRequest(body)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	options, err := srv.parseOptionsFromRequest(r)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	options.ApplyCSR(csr)
+	if options.Name == "" {
+		err = errors.New("Error in options parsing: no name given and no common name in request")
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	vars := mux.Vars(r)
+	ca := vars["ca"]
+	var id string
 	switch entityType(vars["typ"]) {
 	case caType:
-		{
-			if _, ok := caEntity.CAs[vars["id"]]; !ok {
-				if err != nil {
-					w.WriteHeader(http.StatusNotFound)
-					return
-				}
-			}
-			ent, e := srv.mgr.GetCA(vars["id"])
-			if ent != nil {
-				entity = ent.Entity
-			}
-			if e != nil {
-				err = e
-			}
-		}
+		id, err = srv.mgr.CreateCA(ca, options)
 	case clientType:
-		{
-			if _, ok := caEntity.Clients[vars["id"]]; !ok {
-				if err != nil {
-					w.WriteHeader(http.StatusNotFound)
-					return
-				}
-			}
-			entity, err = srv.mgr.GetClient(vars["id"])
-		}
+		id, err = srv.mgr.CreateClient(ca, options)
 	case serverType:
-		{
-			if _, ok := caEntity.Servers[vars["id"]]; !ok {
-				if err != nil {
-					w.WriteHeader(http.StatusNotFound)
-					return
-				}
-			}
-			entity, err = srv.mgr.GetServer(vars["id"])
-		}
+		id, err = srv.mgr.CreateServer(ca, options)
+	default:
+		err = fmt.Errorf("unknown entity type %v", vars["typ"])
 	}
-	if err != nil || entity == nil {
+	if err != nil {
 		log.Print(err)
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte(err.Error()))
 		return
 	}
-	w.Write([]byte(entity.Cert))
+	w.Write([]byte(id))
+}
+
+func (srv *Server) handleGetCert(w http.ResponseWriter, r *http.Request) {
+	entity := srv.lookupEntity(w, r)
+	if entity == nil {
+		return
+	}
+	writeCertificates(w, r, entity.Cert, entity.ID)
 }
 
 func (srv *Server) handleGetKey(w http.ResponseWriter, r *http.Request) {
+	entity := srv.lookupEntity(w, r)
+	if entity == nil {
+		return
+	}
+	srv.writeKey(w, r, entity.Key, entity.ID)
+}
+
+// handleGetChain writes the certificate followed by its issuers, the root is included with root=true.
+// The fullchain never contains the root, as expected by web servers like nginx.
+func (srv *Server) handleGetChain(w http.ResponseWriter, r *http.Request, fullchain bool) {
 	vars := mux.Vars(r)
-	ca := vars["ca"]
-	caEntity, err := srv.mgr.GetCA(ca)
+	typ, ok := storageTypes[entityType(vars["typ"])]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("unknown entity type %v", vars["typ"])))
+		return
+	}
+	includeRoot := false
+	if rootStr := r.FormValue("root"); rootStr != "" && !fullchain {
+		var err error
+		includeRoot, err = strconv.ParseBool(rootStr)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(fmt.Sprintf("Error in options parsing: can not parse root (%v)", err)))
+			return
+		}
+	}
+	chain, err := srv.mgr.GetChain(vars["ca"], typ, vars["id"], includeRoot)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	name := vars["id"] + "-chain"
+	if fullchain {
+		name = vars["id"] + "-fullchain"
+	}
+	writeCertificates(w, r, chain, name)
+}
+
+func (srv *Server) handleGetBundle(w http.ResponseWriter, r *http.Request) {
+	ca := mux.Vars(r)["ca"]
+	bundle, err := srv.mgr.GetBundle(ca)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	writeCertificates(w, r, bundle, ca+"-bundle")
+}
+
+func (srv *Server) handleGetPKCS12(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	typ, ok := storageTypes[entityType(vars["typ"])]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("unknown entity type %v", vars["typ"])))
+		return
+	}
+	legacy := false
+	if legacyStr := r.FormValue("legacy"); legacyStr != "" {
+		var err error
+		legacy, err = strconv.ParseBool(legacyStr)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(fmt.Sprintf("Error in options parsing: can not parse legacy (%v)", err)))
+			return
+		}
+	}
+	// the password is only accepted in the request body so it does not end up in access logs
+	data, err := srv.mgr.GetPKCS12(vars["ca"], typ, vars["id"], r.PostFormValue("password"), legacy)
 	if err != nil {
 		log.Print(err)
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte(err.Error()))
 		return
 	}
-	var entity *types.Entity
+	writeDownload(w, data, "application/x-pkcs12", vars["id"]+".p12")
+}
+
+func (srv *Server) handleGetJWK(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	typ, ok := storageTypes[entityType(vars["typ"])]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("unknown entity type %v", vars["typ"])))
+		return
+	}
+	jwk, err := srv.mgr.GetJWK(vars["ca"], typ, vars["id"])
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/jwk+json")
+	json.NewEncoder(w).Encode(jwk)
+}
+
+func (srv *Server) handleGetJWKS(w http.ResponseWriter, r *http.Request) {
+	jwks, err := srv.mgr.GetJWKS(mux.Vars(r)["ca"])
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	json.NewEncoder(w).Encode(jwks)
+}
+
+// lookupEntity loads the entity addressed by the ca, typ and id route variables.
+// On failure it writes the error response and returns nil.
+func (srv *Server) lookupEntity(w http.ResponseWriter, r *http.Request) *types.Entity {
+	vars := mux.Vars(r)
+	caEntity, err := srv.mgr.GetCA(vars["ca"])
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return nil
+	}
+	id := vars["id"]
+	var (
+		children map[string]string
+		entity   *types.Entity
+	)
 	switch entityType(vars["typ"]) {
 	case caType:
-		{
-			if _, ok := caEntity.CAs[vars["id"]]; !ok {
-				if err != nil {
-					w.WriteHeader(http.StatusNotFound)
-					return
-				}
-			}
-			ent, e := srv.mgr.GetCA(vars["id"])
-			if ent != nil {
-				entity = ent.Entity
-			}
-			if e != nil {
-				err = e
-			}
-		}
+		children = caEntity.CAs
 	case clientType:
-		{
-			if _, ok := caEntity.Clients[vars["id"]]; !ok {
-				if err != nil {
-					w.WriteHeader(http.StatusNotFound)
-					return
-				}
-			}
-			entity, err = srv.mgr.GetClient(vars["id"])
-		}
+		children = caEntity.Clients
 	case serverType:
-		{
-			if _, ok := caEntity.Servers[vars["id"]]; !ok {
-				if err != nil {
-					w.WriteHeader(http.StatusNotFound)
-					return
-				}
-			}
-			entity, err = srv.mgr.GetServer(vars["id"])
+		children = caEntity.Servers
+	case issuedType:
+		children = caEntity.Issued
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("unknown entity type %v", vars["typ"])))
+		return nil
+	}
+	if _, ok := children[id]; !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+	switch entityType(vars["typ"]) {
+	case caType:
+		ca, e := srv.mgr.GetCA(id)
+		if ca != nil {
+			entity = ca.Entity
 		}
+		err = e
+	case clientType:
+		entity, err = srv.mgr.GetClient(id)
+	case serverType:
+		entity, err = srv.mgr.GetServer(id)
+	case issuedType:
+		entity, err = srv.mgr.GetIssued(id)
 	}
-	if err != nil || entity == nil {
+	if err != nil {
 		log.Print(err)
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte(err.Error()))
-		return
+		return nil
 	}
-	w.Write([]byte(entity.Key))
+	return entity
 }
 
 func (srv *Server) handleGetCAKey(w http.ResponseWriter, r *http.Request) {
@@ -269,7 +693,71 @@ func (srv *Server) handleGetCAKey(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(err.Error()))
 		return
 	}
-	w.Write([]byte(caEntity.Key))
+	srv.writeKey(w, r, caEntity.Key, ca)
+}
+
+func (srv *Server) writeKey(w http.ResponseWriter, r *http.Request, key string, name string) {
+	if key == "" {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("no private key stored"))
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" && strings.Contains(r.Header.Get("Accept"), "application/pkcs8") {
+		format = "pkcs8"
+	}
+	if passphrase := r.PostFormValue("passphrase"); passphrase != "" {
+		srv.writeEncryptedKey(w, r, key, passphrase, name)
+		return
+	}
+	if srv.RequireEncryptedKeys {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("unencrypted key download is disabled, supply a passphrase"))
+		return
+	}
+	switch format {
+	case "":
+		writeDownload(w, []byte(key), "application/x-pem-file", name+".key.pem")
+	case "pkcs8":
+		k, err := entity.ParsePrivateKeyPEM([]byte(key))
+		if err != nil {
+			log.Print(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		out, err := (&entity.Entity{Key: k}).GetKeyAsPKCS8PEM()
+		if err != nil {
+			log.Print(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		writeDownload(w, out, "application/x-pem-file", name+".key.pem")
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("unknown key format (try pkcs8)"))
+	}
+}
+
+// writeEncryptedKey writes the key as encrypted PKCS#8, the passphrase is only accepted
+// in the request body so it does not end up in access logs
+func (srv *Server) writeEncryptedKey(w http.ResponseWriter, r *http.Request, key, passphrase, name string) {
+	k, err := entity.ParsePrivateKeyPEM([]byte(key))
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	out, err := (&entity.Entity{Key: k}).GetKeyAsEncryptedPKCS8PEM([]byte(passphrase), r.FormValue("kdf"))
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	writeDownload(w, out, "application/x-pem-file", name+".key.pem")
 }
 
 func (srv *Server) handleGetCACert(w http.ResponseWriter, r *http.Request) {
@@ -282,35 +770,93 @@ func (srv *Server) handleGetCACert(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(err.Error()))
 		return
 	}
-	w.Write([]byte(caEntity.Cert))
+	writeCertificates(w, r, caEntity.Cert, ca)
 }
 
-func (srv *Server) handleGetCRL(w http.ResponseWriter, r *http.Request) {
+func (srv *Server) handleGetCAConfig(w http.ResponseWriter, r *http.Request) {
+	caEntity, err := srv.mgr.GetCA(mux.Vars(r)["ca"])
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	json.NewEncoder(w).Encode(caEntity.Config)
+}
+
+func (srv *Server) handleUpdateCAConfig(w http.ResponseWriter, r *http.Request) {
+	config := &types.CAConfig{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(config); err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if err := srv.mgr.UpdateCAConfig(mux.Vars(r)["ca"], config); err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write([]byte("saved"))
+}
+
+func (srv *Server) handleGetCRL(w http.ResponseWriter, r *http.Request, delta bool) {
 	vars := mux.Vars(r)
 	ca := vars["ca"]
-	crl, err := srv.mgr.GetCRL(ca)
+	var (
+		crl string
+		err error
+	)
+	name := ca
+	if delta {
+		crl, err = srv.mgr.GetDeltaCRL(ca)
+		name = ca + "-delta"
+	} else {
+		crl, err = srv.mgr.GetCRL(ca)
+	}
 	if err != nil {
 		log.Print(err)
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte(err.Error()))
 		return
 	}
-	w.Write([]byte(crl))
+	writeCRL(w, r, crl, name)
 }
 
 func (srv *Server) handleRevoke(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	ca := vars["ca"]
-	typ := vars["typ"]
-	id := vars["id"]
-	var err error
-	switch entityType(typ) {
-	case caType:
-		err = srv.mgr.RevokeCA(ca, id)
-	case clientType:
-		err = srv.mgr.RevokeClient(ca, id)
-	case serverType:
-		err = srv.mgr.RevokeServer(ca, id)
+	typ, ok := storageTypes[entityType(vars["typ"])]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("unknown entity type %v", vars["typ"])))
+		return
+	}
+	revocation, err := parseRevocationFromRequest(r)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	cascade := false
+	if cascadeStr := r.FormValue("cascade"); cascadeStr != "" {
+		cascade, err = strconv.ParseBool(cascadeStr)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(fmt.Sprintf("Error in options parsing: can not parse cascade (%v)", err)))
+			return
+		}
+	}
+	if cascade && typ != types.CA {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("cascade is only supported for CA's"))
+		return
+	}
+	if cascade {
+		err = srv.mgr.RevokeCACascading(vars["ca"], vars["id"], revocation)
+	} else {
+		err = srv.mgr.Revoke(vars["ca"], typ, vars["id"], revocation)
 	}
 	if err != nil {
 		log.Print(err)
@@ -321,6 +867,79 @@ func (srv *Server) handleRevoke(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("revoked"))
 }
 
+func parseRevocationFromRequest(r *http.Request) (*types.Revocation, error) {
+	revocation := &types.Revocation{Comment: r.FormValue("comment")}
+	if reasonStr := r.FormValue("reason"); reasonStr != "" {
+		reason, err := manager.ParseRevocationReason(reasonStr)
+		if err != nil {
+			return nil, fmt.Errorf("Error in options parsing: can not parse reason (%v)", err)
+		}
+		revocation.Reason = reason
+	}
+	if invalidityDateStr := r.FormValue("invalidityDate"); invalidityDateStr != "" {
+		invalidityDateUnix, err := strconv.ParseInt(invalidityDateStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Error in options parsing: can not parse invalidityDate (%v)", err)
+		}
+		revocation.InvalidityDate = time.Unix(invalidityDateUnix, 0)
+	}
+	return revocation, nil
+}
+
+func (srv *Server) handleRenew(w http.ResponseWriter, r *http.Request, rekey bool) {
+	vars := mux.Vars(r)
+	typ, ok := storageTypes[entityType(vars["typ"])]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("unknown entity type %v", vars["typ"])))
+		return
+	}
+	options, err := srv.parseOptionsFromRequest(r)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	revokeOld := false
+	if revokeStr := r.FormValue("revoke"); revokeStr != "" {
+		revokeOld, err = strconv.ParseBool(revokeStr)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(fmt.Sprintf("Error in options parsing: can not parse revoke (%v)", err)))
+			return
+		}
+	}
+	if rekey {
+		err = srv.mgr.Rekey(vars["ca"], typ, vars["id"], options, revokeOld)
+	} else {
+		err = srv.mgr.Renew(vars["ca"], typ, vars["id"], options, revokeOld)
+	}
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if rekey {
+		w.Write([]byte("rekeyed"))
+	} else {
+		w.Write([]byte("renewed"))
+	}
+}
+
+func (srv *Server) handleGetHistory(w http.ResponseWriter, r *http.Request) {
+	entity := srv.lookupEntity(w, r)
+	if entity == nil {
+		return
+	}
+	certs := entity.PreviousCerts
+	if certs == nil {
+		certs = []string{}
+	}
+	json.NewEncoder(w).Encode(certs)
+}
+
 func (srv *Server) handleList(w http.ResponseWriter, r *http.Request, typ string) {
 	vars := mux.Vars(r)
 	ca := vars["ca"]
@@ -340,6 +959,10 @@ func (srv *Server) handleList(w http.ResponseWriter, r *http.Request, typ string
 		encoder.Encode(caEntity.Clients)
 	case serverType:
 		encoder.Encode(caEntity.Servers)
+	case issuedType:
+		encoder.Encode(caEntity.Issued)
+	case sshType:
+		encoder.Encode(caEntity.SSHCerts)
 	}
 }
 
@@ -359,22 +982,38 @@ func (srv *Server) handleGetCA(w http.ResponseWriter, r *http.Request, typ strin
 			Name:      caEntity.Entity.Name,
 			IsRevoked: caEntity.Entity.IsRevoked,
 		},
-		Revoked: caEntity.Revoked,
+		Parent:  caEntity.Parent,
+		Subject: caEntity.Subject,
+		Config:  caEntity.Config,
 		Clients: caEntity.Clients,
 		Servers: caEntity.Servers,
 		CAs:     caEntity.CAs,
+		Issued:  caEntity.Issued,
+
+		Revocations: caEntity.Revocations,
+		Revoked:     caEntity.Revoked,
+
+		SSHCerts:   caEntity.SSHCerts,
+		SSHRevoked: caEntity.SSHRevoked,
 	}
 	encoder := json.NewEncoder(w)
 	encoder.Encode(result)
 }
 
 func (srv *Server) parseCreateOptionsFromRequest(r *http.Request) (*generator.Options, error) {
-	options := &generator.Options{}
-	if name := r.FormValue("name"); name != "" {
-		options.Name = name
-	} else {
+	options, err := srv.parseOptionsFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	if options.Name == "" {
 		return nil, errors.New("Error in options parsing: no name given")
 	}
+	return options, nil
+}
+
+func (srv *Server) parseOptionsFromRequest(r *http.Request) (*generator.Options, error) {
+	options := &generator.Options{}
+	options.Name = r.FormValue("name")
 
 	if rsaBitsStr := r.FormValue("rsaBits"); rsaBitsStr != "" {
 		rsaBits, err := strconv.ParseInt(rsaBitsStr, 10, 32)
@@ -383,6 +1022,9 @@ func (srv *Server) parseCreateOptionsFromRequest(r *http.Request) (*generator.Op
 		}
 		options.RsaBits = int(rsaBits)
 	}
+	if keyType := r.FormValue("keyType"); keyType != "" {
+		options.KeyType = keyType
+	}
 	if curve := r.FormValue("curve"); curve != "" {
 		options.Curve = curve
 	}
@@ -400,5 +1042,118 @@ func (srv *Server) parseCreateOptionsFromRequest(r *http.Request) (*generator.Op
 		}
 		options.ValidFor = validFor
 	}
+	options.Subject = types.Subject{
+		Organization:       r.Form["organization"],
+		OrganizationalUnit: r.Form["organizationalUnit"],
+		Country:            r.Form["country"],
+		Province:           r.Form["province"],
+		Locality:           r.Form["locality"],
+		StreetAddress:      r.Form["streetAddress"],
+		PostalCode:         r.Form["postalCode"],
+		SerialNumber:       r.FormValue("serialNumber"),
+	}
+	options.DNSNames = r.Form["dns"]
+	options.EmailAddresses = r.Form["email"]
+	for _, ipStr := range r.Form["ip"] {
+		ip := net.ParseIP(ipStr)
+		if ip == nil {
+			return nil, fmt.Errorf("Error in options parsing: can not parse ip (%v)", ipStr)
+		}
+		options.IPAddresses = append(options.IPAddresses, ip)
+	}
+	for _, uriStr := range r.Form["uri"] {
+		uri, err := url.Parse(uriStr)
+		if err != nil {
+			return nil, fmt.Errorf("Error in options parsing: can not parse uri (%v)", err)
+		}
+		options.URIs = append(options.URIs, uri)
+	}
+	for _, policyStr := range r.Form["policy"] {
+		parts := strings.SplitN(policyStr, ",", 2)
+		policy := types.Policy{ID: parts[0]}
+		if len(parts) == 2 {
+			policy.CPS = parts[1]
+		}
+		options.Policies = append(options.Policies, policy)
+	}
+	if err := generator.ValidatePolicies(options.Policies); err != nil {
+		return nil, fmt.Errorf("Error in options parsing: can not parse policy (%v)", err)
+	}
+	if mustStapleStr := r.FormValue("mustStaple"); mustStapleStr != "" {
+		mustStaple, err := strconv.ParseBool(mustStapleStr)
+		if err != nil {
+			return nil, fmt.Errorf("Error in options parsing: can not parse mustStaple (%v)", err)
+		}
+		options.MustStaple = mustStaple
+	}
+	for _, extStr := range r.Form["ext"] {
+		ext, err := parseExtension(extStr)
+		if err != nil {
+			return nil, fmt.Errorf("Error in options parsing: can not parse ext (%v)", err)
+		}
+		options.ExtraExtensions = append(options.ExtraExtensions, ext)
+	}
+	if err := generator.ValidateExtensions(options.ExtraExtensions); err != nil {
+		return nil, fmt.Errorf("Error in options parsing: can not use ext (%v)", err)
+	}
+	options.CAConfig = types.CAConfig{
+		ValidityPolicy:     r.FormValue("validityPolicy"),
+		MaxValidFor:        r.FormValue("maxValidFor"),
+		MaxBackdate:        r.FormValue("maxBackdate"),
+		SerialStrategy:     r.FormValue("serialStrategy"),
+		SignatureAlgorithm: r.FormValue("signatureAlgorithm"),
+		CRLURL:             r.FormValue("crlURL"),
+		IssuerURL:          r.FormValue("issuerURL"),
+		OCSPURL:            r.FormValue("ocspURL"),
+		CRLValidity:        r.FormValue("crlValidity"),
+		CRLInterval:        r.FormValue("crlInterval"),
+		DeltaCRLValidity:   r.FormValue("deltaCRLValidity"),
+	}
+	if maxPathLenStr := r.FormValue("maxPathLen"); maxPathLenStr != "" {
+		maxPathLen, err := strconv.ParseInt(maxPathLenStr, 10, 32)
+		if err != nil || maxPathLen < 0 {
+			return nil, fmt.Errorf("Error in options parsing: can not parse maxPathLen (%v)", maxPathLenStr)
+		}
+		options.MaxPathLen = int(maxPathLen)
+		options.MaxPathLenZero = maxPathLen == 0
+	}
+	options.PermittedDNSDomains = r.Form["permittedDNS"]
+	options.ExcludedDNSDomains = r.Form["excludedDNS"]
+	for _, cidr := range r.Form["permittedIP"] {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("Error in options parsing: can not parse permittedIP (%v)", err)
+		}
+		options.PermittedIPRanges = append(options.PermittedIPRanges, ipNet)
+	}
+	for _, cidr := range r.Form["excludedIP"] {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("Error in options parsing: can not parse excludedIP (%v)", err)
+		}
+		options.ExcludedIPRanges = append(options.ExcludedIPRanges, ipNet)
+	}
 	return options, nil
 }
+
+// parseExtension parses extensions given as "oid:base64-der" or "oid:critical:base64-der"
+func parseExtension(s string) (pkix.Extension, error) {
+	parts := strings.Split(s, ":")
+	ext := pkix.Extension{}
+	switch {
+	case len(parts) == 3 && parts[1] == "critical":
+		ext.Critical = true
+	case len(parts) != 2:
+		return ext, fmt.Errorf("invalid extension %v (expected oid[:critical]:base64-value)", s)
+	}
+	oid, err := generator.ParseOID(parts[0])
+	if err != nil {
+		return ext, err
+	}
+	ext.Id = oid
+	ext.Value, err = base64.StdEncoding.DecodeString(parts[len(parts)-1])
+	if err != nil {
+		return ext, err
+	}
+	return ext, nil
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/trusch/pkid/entity"
+)
+
+// downloadFormat returns the format requested with ?format= or the Accept header, pem is the default
+func downloadFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "application/pkix-cert"), strings.Contains(accept, "application/pkix-crl"):
+		return "der"
+	case strings.Contains(accept, "application/pkcs7-mime"), strings.Contains(accept, "application/x-pkcs7-certificates"):
+		return "p7b"
+	}
+	return "pem"
+}
+
+// writeCertificates writes pem encoded certificates as pem, der (only single certificates) or p7b
+func writeCertificates(w http.ResponseWriter, r *http.Request, certs string, name string) {
+	format := downloadFormat(r)
+	if format == "pem" {
+		writeDownload(w, []byte(certs), "application/x-pem-file", name+".pem")
+		return
+	}
+	if format != "der" && format != "p7b" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("unknown format %v (try pem, der or p7b)", format)))
+		return
+	}
+	var certificates []*x509.Certificate
+	rest := []byte(certs)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		certificates = append(certificates, cert)
+	}
+	if format == "der" {
+		if len(certificates) != 1 {
+			w.WriteHeader(http.StatusNotAcceptable)
+			w.Write([]byte("der can only hold a single certificate, use p7b for chains"))
+			return
+		}
+		writeDownload(w, certificates[0].Raw, "application/pkix-cert", name+".cer")
+		return
+	}
+	data, err := entity.EncodePKCS7Certificates(certificates)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	writeDownload(w, data, "application/pkcs7-mime", name+".p7b")
+}
+
+// writeCRL writes a pem encoded CRL as pem or der
+func writeCRL(w http.ResponseWriter, r *http.Request, crl string, name string) {
+	switch format := downloadFormat(r); format {
+	case "pem":
+		writeDownload(w, []byte(crl), "application/x-pem-file", name+".crl.pem")
+	case "der":
+		block, _ := pem.Decode([]byte(crl))
+		if block == nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("no valid PEM data"))
+			return
+		}
+		writeDownload(w, block.Bytes, "application/pkix-crl", name+".crl")
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("unknown format %v (try pem or der)", format)))
+	}
+}
+
+func writeDownload(w http.ResponseWriter, data []byte, contentType, filename string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%v", filename))
+	w.Write(data)
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/trusch/pkid/generator"
+	"golang.org/x/crypto/ssh"
+)
+
+func (srv *Server) handleGetSSHPublicKey(w http.ResponseWriter, r *http.Request) {
+	key, err := srv.mgr.GetSSHPublicKey(mux.Vars(r)["ca"])
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(key))
+}
+
+func (srv *Server) handleSignSSHKey(w http.ResponseWriter, r *http.Request) {
+	options, err := parseSSHOptionsFromRequest(r)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	id, err := srv.mgr.SignSSHKey(mux.Vars(r)["ca"], options)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write([]byte(id))
+}
+
+func (srv *Server) handleGetSSHCert(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	cert, err := srv.mgr.GetSSHCert(vars["ca"], vars["id"])
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(cert.Cert))
+}
+
+func (srv *Server) handleRevokeSSHCert(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := srv.mgr.RevokeSSHCert(vars["ca"], vars["id"]); err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write([]byte("revoked"))
+}
+
+func (srv *Server) handleGetKRL(w http.ResponseWriter, r *http.Request) {
+	ca := mux.Vars(r)["ca"]
+	krl, err := srv.mgr.GetKRL(ca)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	writeDownload(w, krl, "application/octet-stream", ca+".krl")
+}
+
+func parseSSHOptionsFromRequest(r *http.Request) (*generator.SSHOptions, error) {
+	options := &generator.SSHOptions{
+		KeyID:      r.FormValue("keyId"),
+		CertType:   r.FormValue("certType"),
+		Principals: r.Form["principal"],
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(r.FormValue("publicKey")))
+	if err != nil {
+		return nil, fmt.Errorf("Error in options parsing: can not parse publicKey (%v)", err)
+	}
+	options.PublicKey = key
+	if validAfterUnixStr := r.FormValue("validAfter"); validAfterUnixStr != "" {
+		validAfterUnix, err := strconv.ParseInt(validAfterUnixStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Error in options parsing: can not parse validAfter (%v)", err)
+		}
+		options.ValidAfter = time.Unix(validAfterUnix, 0)
+	}
+	if validForStr := r.FormValue("validFor"); validForStr != "" {
+		validFor, err := time.ParseDuration(validForStr)
+		if err != nil {
+			return nil, fmt.Errorf("Error in options parsing: can not parse validFor (%v)", err)
+		}
+		options.ValidFor = validFor
+	}
+	if opts := r.Form["criticalOption"]; len(opts) > 0 {
+		options.CriticalOptions = parseSSHPermissions(opts)
+	}
+	if exts := r.Form["extension"]; len(exts) > 0 {
+		options.Extensions = parseSSHPermissions(exts)
+	}
+	return options, nil
+}
+
+// parseSSHPermissions parses critical options and extensions given as "name" or "name=value"
+func parseSSHPermissions(values []string) map[string]string {
+	permissions := make(map[string]string)
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		permissions[parts[0]] = ""
+		if len(parts) == 2 {
+			permissions[parts[0]] = parts[1]
+		}
+	}
+	return permissions
+}
@@ -1,6 +1,10 @@
 package storage
 
-import "github.com/trusch/pkid/types"
+import (
+	"math/big"
+
+	"github.com/trusch/pkid/types"
+)
 
 // Storage Interface
 type Storage interface {
@@ -9,6 +13,17 @@ type Storage interface {
 	SaveClient(client *types.Entity) error
 	SaveServer(server *types.Entity) error
 	LoadCA(id string) (*types.CAEntity, error)
+	ListCAs() ([]string, error)
 	LoadClient(clientID string) (*types.Entity, error)
 	LoadServer(serverID string) (*types.Entity, error)
+	SaveIssued(issued *types.Entity) error
+	LoadIssued(issuedID string) (*types.Entity, error)
+	SaveProfile(profile *types.Profile) error
+	LoadProfile(name string) (*types.Profile, error)
+	DeleteProfile(name string) error
+	ListProfiles() ([]string, error)
+	SaveSerial(caID string, serial *big.Int, entityID string) error
+	LoadSerial(caID string, serial *big.Int) (string, error)
+	SaveSSHCert(cert *types.SSHCert) error
+	LoadSSHCert(id string) (*types.SSHCert, error)
 }
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"encoding/json"
+	"math/big"
 
 	uuid "github.com/satori/go.uuid"
 	"github.com/trusch/pkid/types"
@@ -18,6 +19,13 @@ const (
 	clientBucket string = "pkid-clients"
 	caBucket            = "pkid-cas"
 	serverBucket        = "pkid-servers"
+	issuedBucket        = "pkid-issued"
+	profileBucket       = "pkid-profiles"
+	indexBucket         = "pkid-index"
+	serialBucket        = "pkid-serials"
+	sshBucket           = "pkid-ssh-certs"
+	profileIndex        = "profiles"
+	caIndex             = "cas"
 )
 
 // New returnes a new pki storage using github.com/trusch/storage
@@ -39,6 +47,21 @@ func New(uri string, token ...string) (*StorageImpl, error) {
 	if err = store.CreateBucket(caBucket); err != nil {
 		return nil, err
 	}
+	if err = store.CreateBucket(issuedBucket); err != nil {
+		return nil, err
+	}
+	if err = store.CreateBucket(profileBucket); err != nil {
+		return nil, err
+	}
+	if err = store.CreateBucket(indexBucket); err != nil {
+		return nil, err
+	}
+	if err = store.CreateBucket(serialBucket); err != nil {
+		return nil, err
+	}
+	if err = store.CreateBucket(sshBucket); err != nil {
+		return nil, err
+	}
 	return &StorageImpl{store}, nil
 }
 
@@ -48,13 +71,36 @@ func (s *StorageImpl) GetID() string {
 	return u1.String()
 }
 
-// SaveCA saves a CA to backend
+// SaveCA saves a CA to backend and adds it to the CA index
 func (s *StorageImpl) SaveCA(ca *types.CAEntity) error {
 	bs, err := json.Marshal(ca)
 	if err != nil {
 		return err
 	}
-	return s.store.Put(caBucket, ca.ID, bs)
+	if err = s.store.Put(caBucket, ca.ID, bs); err != nil {
+		return err
+	}
+	return s.indexCA(ca.ID)
+}
+
+// ListCAs returns the IDs of all CA's in the CA index.
+// CA's of versions before the index are added the first time they are loaded or saved.
+func (s *StorageImpl) ListCAs() ([]string, error) {
+	return s.loadIndex(caIndex)
+}
+
+// indexCA adds a CA to the CA index if it is missing
+func (s *StorageImpl) indexCA(caID string) error {
+	ids, err := s.ListCAs()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if id == caID {
+			return nil
+		}
+	}
+	return s.saveIndex(caIndex, append(ids, caID))
 }
 
 // SaveClient saves a client to backend
@@ -75,7 +121,7 @@ func (s *StorageImpl) SaveServer(server *types.Entity) error {
 	return s.store.Put(serverBucket, server.ID, bs)
 }
 
-// LoadCA loads a CA from backend
+// LoadCA loads a CA from backend, CA's of older versions are added to the CA index
 func (s *StorageImpl) LoadCA(id string) (*types.CAEntity, error) {
 	bs, err := s.store.Get(caBucket, id)
 	if err != nil {
@@ -86,6 +132,9 @@ func (s *StorageImpl) LoadCA(id string) (*types.CAEntity, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err = s.indexCA(id); err != nil {
+		return nil, err
+	}
 	return entity, nil
 }
 
@@ -116,3 +165,147 @@ func (s *StorageImpl) LoadServer(serverID string) (*types.Entity, error) {
 	}
 	return entity, nil
 }
+
+// SaveIssued saves a profile based certificate to backend
+func (s *StorageImpl) SaveIssued(issued *types.Entity) error {
+	bs, err := json.Marshal(issued)
+	if err != nil {
+		return err
+	}
+	return s.store.Put(issuedBucket, issued.ID, bs)
+}
+
+// LoadIssued loads a profile based certificate from backend
+func (s *StorageImpl) LoadIssued(issuedID string) (*types.Entity, error) {
+	bs, err := s.store.Get(issuedBucket, issuedID)
+	if err != nil {
+		return nil, err
+	}
+	entity := &types.Entity{}
+	err = json.Unmarshal(bs, entity)
+	if err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// SaveProfile saves a profile to backend and adds it to the profile index
+func (s *StorageImpl) SaveProfile(profile *types.Profile) error {
+	bs, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+	if err = s.store.Put(profileBucket, profile.Name, bs); err != nil {
+		return err
+	}
+	names, err := s.ListProfiles()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if name == profile.Name {
+			return nil
+		}
+	}
+	return s.saveIndex(profileIndex, append(names, profile.Name))
+}
+
+// LoadProfile loads a profile from backend
+func (s *StorageImpl) LoadProfile(name string) (*types.Profile, error) {
+	bs, err := s.store.Get(profileBucket, name)
+	if err != nil {
+		return nil, err
+	}
+	profile := &types.Profile{}
+	err = json.Unmarshal(bs, profile)
+	if err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// DeleteProfile removes a profile from backend and from the profile index
+func (s *StorageImpl) DeleteProfile(name string) error {
+	names, err := s.ListProfiles()
+	if err != nil {
+		return err
+	}
+	remaining := make([]string, 0, len(names))
+	for _, n := range names {
+		if n != name {
+			remaining = append(remaining, n)
+		}
+	}
+	if err = s.saveIndex(profileIndex, remaining); err != nil {
+		return err
+	}
+	return s.store.Delete(profileBucket, name)
+}
+
+// ListProfiles returns the names of all stored profiles
+func (s *StorageImpl) ListProfiles() ([]string, error) {
+	return s.loadIndex(profileIndex)
+}
+
+func (s *StorageImpl) loadIndex(index string) ([]string, error) {
+	names := []string{}
+	bs, err := s.store.Get(indexBucket, index)
+	if err != nil {
+		// nothing saved yet
+		return names, nil
+	}
+	err = json.Unmarshal(bs, &names)
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+func (s *StorageImpl) saveIndex(index string, names []string) error {
+	bs, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+	return s.store.Put(indexBucket, index, bs)
+}
+
+// SaveSerial adds a serial issued by a CA to the serial index
+func (s *StorageImpl) SaveSerial(caID string, serial *big.Int, entityID string) error {
+	return s.store.Put(serialBucket, serialKey(caID, serial), []byte(entityID))
+}
+
+// LoadSerial returns the ID of the entity a CA issued the serial to
+func (s *StorageImpl) LoadSerial(caID string, serial *big.Int) (string, error) {
+	bs, err := s.store.Get(serialBucket, serialKey(caID, serial))
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
+
+// SaveSSHCert saves an OpenSSH certificate to backend
+func (s *StorageImpl) SaveSSHCert(cert *types.SSHCert) error {
+	bs, err := json.Marshal(cert)
+	if err != nil {
+		return err
+	}
+	return s.store.Put(sshBucket, cert.ID, bs)
+}
+
+// LoadSSHCert loads an OpenSSH certificate from backend
+func (s *StorageImpl) LoadSSHCert(id string) (*types.SSHCert, error) {
+	bs, err := s.store.Get(sshBucket, id)
+	if err != nil {
+		return nil, err
+	}
+	cert := &types.SSHCert{}
+	err = json.Unmarshal(bs, cert)
+	if err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+func serialKey(caID string, serial *big.Int) string {
+	return caID + ":" + serial.Text(16)
+}
@@ -42,6 +42,23 @@ func (suite *StorageSuite) TestSaveLoadCA() {
 	suite.Equal(caEntity.Cert, restoredEntity.Cert)
 	suite.Equal(caEntity.Key, restoredEntity.Key)
 	suite.Equal(caEntity.Serial, restoredEntity.Serial)
+	err = suite.store.SaveCA(caEntity)
+	suite.NoError(err)
+	ids, err := suite.store.ListCAs()
+	suite.NoError(err)
+	suite.Equal([]string{caEntity.ID}, ids)
+
+	// CA's of older versions are indexed when they are loaded
+	impl := suite.store.(*StorageImpl)
+	suite.NoError(impl.store.Delete(indexBucket, caIndex))
+	ids, err = suite.store.ListCAs()
+	suite.NoError(err)
+	suite.Empty(ids)
+	_, err = suite.store.LoadCA(caEntity.ID)
+	suite.NoError(err)
+	ids, err = suite.store.ListCAs()
+	suite.NoError(err)
+	suite.Equal([]string{caEntity.ID}, ids)
 }
 
 func (suite *StorageSuite) TestSaveLoadClient() {
@@ -86,6 +103,54 @@ func (suite *StorageSuite) TestSaveLoadServer() {
 	suite.Equal(entity.Key, restoredEntity.Key)
 }
 
+func (suite *StorageSuite) TestSaveLoadIssued() {
+	entity := &types.Entity{ID: suite.store.GetID(), Name: "test-issued", Profile: "mtls-peer"}
+	err := suite.store.SaveIssued(entity)
+	suite.NoError(err)
+	restoredEntity, err := suite.store.LoadIssued(entity.ID)
+	suite.NoError(err)
+	suite.Equal(entity, restoredEntity)
+}
+
+func (suite *StorageSuite) TestSaveLoadDeleteProfile() {
+	profile := &types.Profile{
+		Name:        "test-profile",
+		KeyUsage:    []string{"digitalSignature"},
+		ExtKeyUsage: []string{"clientAuth"},
+		MaxValidity: "24h",
+	}
+	err := suite.store.SaveProfile(profile)
+	suite.NoError(err)
+	err = suite.store.SaveProfile(profile)
+	suite.NoError(err)
+	restoredProfile, err := suite.store.LoadProfile(profile.Name)
+	suite.NoError(err)
+	suite.Equal(profile, restoredProfile)
+	names, err := suite.store.ListProfiles()
+	suite.NoError(err)
+	suite.Equal([]string{"test-profile"}, names)
+	err = suite.store.DeleteProfile(profile.Name)
+	suite.NoError(err)
+	_, err = suite.store.LoadProfile(profile.Name)
+	suite.Error(err)
+	names, err = suite.store.ListProfiles()
+	suite.NoError(err)
+	suite.Empty(names)
+}
+
+func (suite *StorageSuite) TestSaveLoadSerial() {
+	caID := suite.store.GetID()
+	_, err := suite.store.LoadSerial(caID, big.NewInt(42))
+	suite.Error(err)
+	err = suite.store.SaveSerial(caID, big.NewInt(42), "entity-id")
+	suite.NoError(err)
+	id, err := suite.store.LoadSerial(caID, big.NewInt(42))
+	suite.NoError(err)
+	suite.Equal("entity-id", id)
+	_, err = suite.store.LoadSerial(suite.store.GetID(), big.NewInt(42))
+	suite.Error(err)
+}
+
 // func TestStorageImplWithLevelDB(t *testing.T) {
 // 	store, err := New("leveldb://test-store.db")
 // 	assert.NoError(t, err)
@@ -1,7 +1,10 @@
 package types
 
 // EntityType is the storage entity type
-import "math/big"
+import (
+	"math/big"
+	"time"
+)
 
 type EntityType int
 
@@ -10,6 +13,7 @@ const (
 	CA EntityType = iota
 	Server
 	Client
+	Issued
 )
 
 // Entity is ID with a Cert and a Key (both pem encoded)
@@ -19,14 +23,140 @@ type Entity struct {
 	Cert      string
 	Key       string
 	IsRevoked bool
+	Profile   string
+	// PreviousCerts holds the certificates replaced by renewals and rekeys, oldest first
+	PreviousCerts []string
+}
+
+// Subject holds the distinguished name attributes of a certificate besides the common name
+type Subject struct {
+	Organization       []string
+	OrganizationalUnit []string
+	Country            []string
+	Province           []string
+	Locality           []string
+	StreetAddress      []string
+	PostalCode         []string
+	SerialNumber       string
 }
 
 // A CAEntity is a Entity with a serial number (used for next issued cert)
+// and a default subject which is inherited by the certificates it issues
 type CAEntity struct {
 	*Entity
+	Parent  string // ID of the issuing CA, empty for root CA's
+	Subject *Subject
+	Config  CAConfig
 	Serial  *big.Int
-	Revoked []*big.Int
 	Clients map[string]string
 	Servers map[string]string
 	CAs     map[string]string
+	Issued  map[string]string
+
+	// Revocations lists the certificates revoked by the CA
+	Revocations []*Revocation
+	// Revoked is the revocation list of older versions,
+	// it is migrated to Revocations on the next revocation or CRL request
+	Revoked []*big.Int
+
+	// CRLs holds the last base and delta CRL, they are only re-signed when they are due
+	CRLs CRLCache
+
+	// SerialsIndexed marks CA's whose issued serials are in the serial index
+	SerialsIndexed bool
+
+	// Imported marks CA's which have been imported, the serials they issued outside of pkid are unknown
+	Imported bool
+
+	// CrossCerts are certificates for the key of this CA issued by other CA's, by ID of the issuer
+	CrossCerts map[string]string
+	// CrossSigned are the CA's this CA has issued a cross-signed certificate for
+	CrossSigned map[string]string
+
+	// SSHSerial is the next serial for OpenSSH certificates, SSHCerts maps their ID's to the key ID's
+	SSHSerial  uint64
+	SSHCerts   map[string]string
+	SSHRevoked []uint64
+}
+
+// CRLCache holds the CRL's of a CA. Base and delta CRL's share the CRL number sequence which starts at 1,
+// Number is the last number used. The revocation counts tell how many Revocations of the CA a CRL covers.
+type CRLCache struct {
+	Number           *big.Int
+	Base             string
+	BaseRevocations  int
+	Delta            string
+	DeltaRevocations int
+}
+
+// Revocation records the revocation of a certificate.
+// Reason is a CRL reason code (RFC 5280, 5.3.1), InvalidityDate is zero if unknown.
+type Revocation struct {
+	Serial         *big.Int
+	Time           time.Time
+	Reason         int
+	InvalidityDate time.Time
+	Comment        string
+}
+
+// SSHCert is an OpenSSH certificate signed with the key of a CA, Cert is in authorized_keys format
+type SSHCert struct {
+	ID        string
+	KeyID     string
+	Serial    uint64
+	Cert      string
+	IsRevoked bool
+}
+
+// CAConfig holds the per-CA issuance settings, durations are strings like "8760h"
+type CAConfig struct {
+	// ValidityPolicy decides what happens to certificates exceeding the CA's limits,
+	// "clamp" (default) shortens their validity, "reject" refuses to issue them
+	ValidityPolicy string
+	MaxValidFor    string
+	MaxBackdate    string
+	// SerialStrategy is "sequential" (default) or "random" (128 bit)
+	SerialStrategy string
+	// SignatureAlgorithm for certificates and CRL's, e.g. "SHA384-RSAPSS" or "ECDSA-SHA256"
+	SignatureAlgorithm string
+	// CRLURL, IssuerURL and OCSPURL are embedded into issued certificates,
+	// CRLURL and IssuerURL default to the endpoints below the public base URL of pkid
+	CRLURL    string
+	IssuerURL string
+	OCSPURL   string
+	// CRLValidity is the time from thisUpdate to nextUpdate of base CRL's (default "8760h").
+	// A new base CRL is issued every CRLInterval, revocations in between are published by delta CRL's.
+	// Without CRLInterval every revocation leads to a new base CRL.
+	// DeltaCRLValidity is the time from thisUpdate to nextUpdate of delta CRL's (default "1h").
+	CRLValidity      string
+	CRLInterval      string
+	DeltaCRLValidity string
+}
+
+// Extension is a raw certificate extension, Value is the DER encoded extension value
+type Extension struct {
+	ID       string
+	Critical bool
+	Value    []byte
+}
+
+// Policy is a certificate policy OID with an optional CPS uri
+type Policy struct {
+	ID  string
+	CPS string
+}
+
+// Profile is a named set of issuance settings.
+// KeyUsage and ExtKeyUsage are lists of names like "digitalSignature" or "serverAuth",
+// KeyAlgorithms restricts the allowed key types (rsa, ecdsa, ed25519) and
+// MaxValidity is a duration string like "8760h"
+type Profile struct {
+	Name          string
+	KeyUsage      []string
+	ExtKeyUsage   []string
+	KeyAlgorithms []string
+	MaxValidity   string
+	Policies      []Policy
+	MustStaple    bool
+	Extensions    []Extension
 }